@@ -35,6 +35,23 @@ type Config struct {
 	ProxyEnabled   bool     `mapstructure:"PROXY_ENABLED"`
 	ProxyNetworks  []string `mapstructure:"PROXY_NETWORKS"` // validate:"dive,cidr,required_if=ProxyEnabled true"`
 	ProxyHeader    string   `mapstructure:"PROXY_HEADER"`   // validate:"required_if=ProxyEnabled true"`
+
+	OIDCIssuer           string `mapstructure:"OIDC_ISSUER" validate:"omitempty,url"`
+	OIDCSigningAlgorithm string `mapstructure:"OIDC_SIGNING_ALGORITHM" validate:"oneof=RS256 ES256"`
+	OIDCKeyRotation      int    `mapstructure:"OIDC_KEY_ROTATION" validate:"min=1"`
+
+	WorkerConcurrency  int `mapstructure:"WORKER_CONCURRENCY" validate:"min=1"`
+	WorkerPollInterval int `mapstructure:"WORKER_POLL_INTERVAL" validate:"min=1"`
+	WorkerJobTimeout   int `mapstructure:"WORKER_JOB_TIMEOUT" validate:"min=1"`
+	WorkerDedupWindow  int `mapstructure:"WORKER_DEDUP_WINDOW" validate:"min=0"`
+
+	AuditRetentionDays int `mapstructure:"AUDIT_RETENTION_DAYS" validate:"min=1"`
+
+	LockoutThreshold    int `mapstructure:"LOCKOUT_THRESHOLD" validate:"min=1"`
+	LockoutDuration     int `mapstructure:"LOCKOUT_DURATION" validate:"min=1"`
+	LockoutMaxDuration  int `mapstructure:"LOCKOUT_MAX_DURATION" validate:"min=1,gtefield=LockoutDuration"`
+	LoginThrottleLimit  int `mapstructure:"LOGIN_THROTTLE_LIMIT" validate:"min=1"`
+	LoginThrottleWindow int `mapstructure:"LOGIN_THROTTLE_WINDOW" validate:"min=1"`
 }
 
 func Load() (*Config, error) {
@@ -47,6 +64,18 @@ func Load() (*Config, error) {
 	viper.SetDefault("AUTH_EXPIRATION", 24)
 	viper.SetDefault("AUTH_DOMAIN", "localhost")
 	viper.SetDefault("AUTH_SECURE", false)
+	viper.SetDefault("OIDC_SIGNING_ALGORITHM", "RS256")
+	viper.SetDefault("OIDC_KEY_ROTATION", 30)
+	viper.SetDefault("WORKER_CONCURRENCY", 4)
+	viper.SetDefault("WORKER_POLL_INTERVAL", 5)
+	viper.SetDefault("WORKER_JOB_TIMEOUT", 30)
+	viper.SetDefault("WORKER_DEDUP_WINDOW", 0)
+	viper.SetDefault("AUDIT_RETENTION_DAYS", 90)
+	viper.SetDefault("LOCKOUT_THRESHOLD", 5)
+	viper.SetDefault("LOCKOUT_DURATION", 15)
+	viper.SetDefault("LOCKOUT_MAX_DURATION", 1_440)
+	viper.SetDefault("LOGIN_THROTTLE_LIMIT", 20)
+	viper.SetDefault("LOGIN_THROTTLE_WINDOW", 15)
 
 	// Enable automatic environment variable binding with the FM_ prefix
 	viper.AutomaticEnv()
@@ -63,6 +92,18 @@ func Load() (*Config, error) {
 	viper.BindEnv("AUTH_DOMAIN", "FM_AUTH_DOMAIN", "AUTH_DOMAIN")
 	viper.BindEnv("AUTH_SECURE", "FM_AUTH_SECURE", "AUTH_SECURE")
 
+	// Bind lockout environment variables
+	viper.BindEnv("LOCKOUT_THRESHOLD", "FM_LOCKOUT_THRESHOLD", "LOCKOUT_THRESHOLD")
+	viper.BindEnv("LOCKOUT_DURATION", "FM_LOCKOUT_DURATION", "LOCKOUT_DURATION")             // Minutes
+	viper.BindEnv("LOCKOUT_MAX_DURATION", "FM_LOCKOUT_MAX_DURATION", "LOCKOUT_MAX_DURATION") // Minutes
+	viper.BindEnv("LOGIN_THROTTLE_LIMIT", "FM_LOGIN_THROTTLE_LIMIT", "LOGIN_THROTTLE_LIMIT")
+	viper.BindEnv("LOGIN_THROTTLE_WINDOW", "FM_LOGIN_THROTTLE_WINDOW", "LOGIN_THROTTLE_WINDOW") // Minutes
+
+	// Bind OpenID Connect environment variables
+	viper.BindEnv("OIDC_ISSUER", "FM_OIDC_ISSUER", "OIDC_ISSUER")
+	viper.BindEnv("OIDC_SIGNING_ALGORITHM", "FM_OIDC_SIGNING_ALGORITHM", "OIDC_SIGNING_ALGORITHM")
+	viper.BindEnv("OIDC_KEY_ROTATION", "FM_OIDC_KEY_ROTATION", "OIDC_KEY_ROTATION") // Days
+
 	// Bind Mailgun environment variables
 	viper.BindEnv("MAILGUN_API_KEY", "FM_MAILGUN_API_KEY", "MAILGUN_API_KEY")
 	viper.BindEnv("MAILGUN_DOMAIN", "FM_MAILGUN_DOMAIN", "MAILGUN_DOMAIN")
@@ -84,6 +125,15 @@ func Load() (*Config, error) {
 	// Bind PDF.co environment variables
 	viper.BindEnv("PDFCO_API_KEY", "FM_PDFCO_API_KEY", "PDFCO_API_KEY")
 
+	// Bind worker environment variables
+	viper.BindEnv("WORKER_CONCURRENCY", "FM_WORKER_CONCURRENCY", "WORKER_CONCURRENCY")
+	viper.BindEnv("WORKER_POLL_INTERVAL", "FM_WORKER_POLL_INTERVAL", "WORKER_POLL_INTERVAL") // Seconds
+	viper.BindEnv("WORKER_JOB_TIMEOUT", "FM_WORKER_JOB_TIMEOUT", "WORKER_JOB_TIMEOUT")       // Minutes
+	viper.BindEnv("WORKER_DEDUP_WINDOW", "FM_WORKER_DEDUP_WINDOW", "WORKER_DEDUP_WINDOW")    // Minutes
+
+	// Bind audit environment variables
+	viper.BindEnv("AUDIT_RETENTION_DAYS", "FM_AUDIT_RETENTION_DAYS", "AUDIT_RETENTION_DAYS")
+
 	viper.SetConfigName("settings")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
@@ -0,0 +1,73 @@
+-- Schema changes of the worker queue: job statuses, deduplication, progress,
+-- attempt history, schedules and per-type queues. The statements are
+-- idempotent, so the file can be applied to a database that already has part
+-- of them. Apply it before starting a server or worker of this version:
+--
+--   psql "$FM_DATABASE_URL" -f app/database/migrations/001_worker_queue.sql
+
+-- A new enum value cannot be used in the transaction that adds it, so these
+-- run on their own
+ALTER TYPE application.job_status ADD VALUE IF NOT EXISTS 'cancelled';
+ALTER TYPE application.job_status ADD VALUE IF NOT EXISTS 'dead';
+
+BEGIN;
+
+ALTER TABLE application.worker_jobs
+    ALTER COLUMN max_retries DROP DEFAULT,
+    ADD COLUMN IF NOT EXISTS dedup_key text,
+    ADD COLUMN IF NOT EXISTS progress bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS progress_message text,
+    ADD COLUMN IF NOT EXISTS result jsonb;
+
+-- Only one active job per dedup key. CreateJob inserts with ON CONFLICT on
+-- this index, so the predicate must match dedupConflict in
+-- app/platform/job/dedup.go.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_worker_jobs_dedup_key
+    ON application.worker_jobs (dedup_key)
+    WHERE dedup_key IS NOT NULL AND status IN ('pending', 'retry', 'running');
+
+CREATE TABLE IF NOT EXISTS application.worker_job_attempts (
+    id bigserial PRIMARY KEY,
+    job_id bigint NOT NULL REFERENCES application.worker_jobs (id) ON DELETE CASCADE,
+    attempt bigint NOT NULL,
+    worker_id text,
+    status application.job_status NOT NULL,
+    error text,
+    started_at timestamptz NOT NULL DEFAULT now(),
+    finished_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_application_worker_job_attempts_job_id
+    ON application.worker_job_attempts (job_id);
+
+CREATE TABLE IF NOT EXISTS application.worker_schedules (
+    name text PRIMARY KEY,
+    job_type text NOT NULL,
+    payload jsonb,
+    cron text NOT NULL,
+    timezone text NOT NULL DEFAULT 'UTC',
+    paused boolean NOT NULL DEFAULT false,
+    next_run_at timestamptz NOT NULL,
+    last_run_at timestamptz,
+    last_job_id bigint,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_application_worker_schedules_next_run_at
+    ON application.worker_schedules (next_run_at);
+
+CREATE TABLE IF NOT EXISTS application.worker_queues (
+    job_type text PRIMARY KEY,
+    max_concurrency bigint NOT NULL DEFAULT 0,
+    rate_limit bigint NOT NULL DEFAULT 0,
+    default_priority bigint,
+    default_max_retries bigint,
+    paused boolean NOT NULL DEFAULT false,
+    rate_window_start timestamptz,
+    rate_window_count bigint NOT NULL DEFAULT 0,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+COMMIT;
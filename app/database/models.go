@@ -67,8 +67,16 @@ func (a *Analysis) TableName() string {
 
 // TODO: Rename to APIKey
 type AuthKey struct {
-	Key    string    `json:"key" gorm:"default:concat('fmsk.', application.random_string(32));primaryKey"` // TODO: Wrap this into a database function
-	UserID uuid.UUID `json:"user_id" gorm:"type:uuid"`
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();uniqueIndex"`
+	Key        string     `json:"-" gorm:"primaryKey"` // SHA-256 hash of the key
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"` // Last characters of the key
+	User       User       `json:"-" gorm:"foreignKey:UserID;references:ID"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;index"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"default:now()"`
+	ExpiredAt  *time.Time `json:"expired_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP *string    `json:"last_used_ip"`
 }
 
 func (ak *AuthKey) TableName() string {
@@ -82,15 +90,22 @@ type User struct {
 	GivenName         *string        `json:"given_name"`
 	LastName          *string        `json:"family_name"` // TODO: Update database column name to family_name
 	Email             string         `json:"email"`
+	EmailVerified     bool           `json:"email_verified" gorm:"default:false"`
 	Avatar            *string        `json:"picture"` // TODO: Update database column name to picture
 	JobTitle          *string        `json:"job_title"`
 	PasswordHash      string         `json:"-"`
 	PhoneNumber       *string        `json:"phone_number"`
 	AccessFailedCount int            `json:"-" gorm:"default:0"`
+	LockoutEnd        *time.Time     `json:"-"`                  // Account is locked until this time
+	LockoutCount      int            `json:"-" gorm:"default:0"` // Lockouts since the last successful login
 	Role              string         `json:"role" gorm:"default:'user'"`
 	LastLogin         time.Time      `json:"-" gorm:"default:now()"`
 	LoginCount        int            `json:"-" gorm:"default:0"`
+	MFASecret         *string        `json:"-"` // Base32 encoded TOTP secret, set during enrolment
+	MFAEnabled        bool           `json:"mfa_enabled" gorm:"default:false"`
+	MFALastStep       *int64         `json:"-"` // TOTP time step of the last accepted code
 	Organizations     []Organization `json:"organizations" gorm:"many2many:application.organization_user;foreignKey:ID;joinForeignKey:user_id;References:ID;joinReferences:organization_id;jointable_columns:role"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 // TableName specifies the database table name for the User model
@@ -99,12 +114,13 @@ func (u *User) TableName() string {
 }
 
 type Organization struct {
-	ID                uuid.UUID   `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
-	Name              string      `json:"name"`
-	Email             string      `json:"-"`                                     // TODO: Remove from db
-	FenceMunicipality StringArray `json:"fence_municipality" gorm:"type:text[]"` // TODO: Move this out of the organization table
-	FenceDistrict     StringArray `json:"fence_district" gorm:"type:text[]"`     // TODO: Move this out of the organization table
-	FenceNeighborhood StringArray `json:"fence_neighborhood" gorm:"type:text[]"` // TODO: Move this out of the organization table
+	ID                uuid.UUID      `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Name              string         `json:"name"`
+	Email             string         `json:"-"`                                     // TODO: Remove from db
+	FenceMunicipality StringArray    `json:"fence_municipality" gorm:"type:text[]"` // TODO: Move this out of the organization table
+	FenceDistrict     StringArray    `json:"fence_district" gorm:"type:text[]"`     // TODO: Move this out of the organization table
+	FenceNeighborhood StringArray    `json:"fence_neighborhood" gorm:"type:text[]"` // TODO: Move this out of the organization table
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 func (o *Organization) TableName() string {
@@ -113,13 +129,15 @@ func (o *Organization) TableName() string {
 
 // Application represents an OAuth application that can access the API
 type Application struct {
-	ApplicationID string     `json:"id" gorm:"primaryKey"`
-	Name          string     `json:"name" validate:"required"`
-	Data          JSONObject `json:"data" gorm:"type:jsonb"`
-	Secret        string     `json:"-"` // TODO Rename to SecretHash
-	RedirectURL   string     `json:"-" validate:"url"`
-	Public        bool       `json:"-"`
-	UserID        uuid.UUID  `json:"-" gorm:"type:uuid"`
+	ApplicationID string      `json:"id" gorm:"primaryKey"`
+	Name          string      `json:"name" validate:"required"`
+	Data          JSONObject  `json:"data" gorm:"type:jsonb"`
+	Secret        string      `json:"-"`                // TODO Rename to SecretHash
+	RedirectURL   string      `json:"-" validate:"url"` // Deprecated: Use RedirectURLs
+	RedirectURLs  StringArray `json:"redirect_urls" gorm:"type:text[]"`
+	Public        bool        `json:"-"`
+	UserID        uuid.UUID   `json:"-" gorm:"type:uuid"`
+	Scopes        StringArray `json:"scopes" gorm:"type:text[]"` // Empty means oauth.DefaultScopes
 }
 
 // TableName specifies the database table name for the Application model
@@ -148,6 +166,9 @@ type AuthCode struct {
 	ExpiredAt           time.Time   `json:"expired_at"`
 	CodeChallenge       string      `json:"code_challenge"`
 	CodeChallengeMethod string      `json:"code_challenge_method"`
+	Scope               string      `json:"scope"`
+	Nonce               string      `json:"nonce"`
+	RedirectURI         string      `json:"redirect_uri"` // As given in the authorization request, checked again when the code is exchanged
 }
 
 func (ac *AuthCode) TableName() string {
@@ -165,15 +186,19 @@ func (rk *ResetKey) TableName() string {
 }
 
 type AuthAccessToken struct {
-	AccessToken   string      `json:"access_token" gorm:"primaryKey"`
-	IPAddress     string      `json:"ip_address"`
-	Application   Application `json:"application" gorm:"foreignKey:ApplicationID;references:ApplicationID"`
-	ApplicationID string      `json:"-" gorm:"type:uuid"`
-	User          User        `json:"user" gorm:"foreignKey:UserID;references:ID"`
-	UserID        uuid.UUID   `json:"-" gorm:"type:uuid"`
-	CreatedAt     time.Time   `json:"created_at" gorm:"default:now()"`
-	UpdatedAt     time.Time   `json:"updated_at"`
-	ExpiredAt     time.Time   `json:"expired_at"`
+	AccessToken    string      `json:"-" gorm:"primaryKey"` // SHA-256 hash of the token
+	IPAddress      string      `json:"ip_address"`
+	UserAgent      string      `json:"user_agent"`
+	Application    Application `json:"application" gorm:"foreignKey:ApplicationID;references:ApplicationID"`
+	ApplicationID  string      `json:"-" gorm:"type:uuid"`
+	User           User        `json:"user" gorm:"foreignKey:UserID;references:ID"`
+	UserID         uuid.UUID   `json:"-" gorm:"type:uuid"`
+	FamilyID       uuid.UUID   `json:"-" gorm:"type:uuid;index"`
+	OrganizationID *uuid.UUID  `json:"organization_id" gorm:"type:uuid"` // Active organization chosen at sign-in
+	Scope          string      `json:"scope"`                            // Space-delimited, "*" for the first-party sign-in
+	CreatedAt      time.Time   `json:"created_at" gorm:"default:now()"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+	ExpiredAt      time.Time   `json:"expired_at"`
 }
 
 func (aat *AuthAccessToken) TableName() string {
@@ -181,22 +206,115 @@ func (aat *AuthAccessToken) TableName() string {
 }
 
 type AuthRefreshToken struct {
-	Token         string      `json:"token" gorm:"primaryKey"`
-	Application   Application `json:"application" gorm:"foreignKey:ApplicationID;references:ApplicationID"`
-	ApplicationID string      `json:"-" gorm:"type:uuid"`
-	User          User        `json:"user" gorm:"foreignKey:UserID;references:ID"`
-	UserID        uuid.UUID   `json:"-" gorm:"type:uuid"`
-	CreatedAt     time.Time   `json:"created_at" gorm:"default:now()"`
-	ExpiredAt     time.Time   `json:"expired_at"`
+	Token          string      `json:"-" gorm:"primaryKey"` // SHA-256 hash of the token
+	IPAddress      string      `json:"ip_address"`
+	UserAgent      string      `json:"user_agent"`
+	Application    Application `json:"application" gorm:"foreignKey:ApplicationID;references:ApplicationID"`
+	ApplicationID  string      `json:"-" gorm:"type:uuid"`
+	User           User        `json:"user" gorm:"foreignKey:UserID;references:ID"`
+	UserID         uuid.UUID   `json:"-" gorm:"type:uuid"`
+	FamilyID       uuid.UUID   `json:"family_id" gorm:"type:uuid;index"` // All tokens rotated from the same sign-in share a family
+	OrganizationID *uuid.UUID  `json:"organization_id" gorm:"type:uuid"`
+	Scope          string      `json:"scope"`
+	CreatedAt      time.Time   `json:"created_at" gorm:"default:now()"`
+	ExpiredAt      time.Time   `json:"expired_at"`
+	RevokedAt      *time.Time  `json:"revoked_at"` // Set when the token is rotated or revoked
 }
 
 func (art *AuthRefreshToken) TableName() string {
 	return "application.auth_refresh_token"
 }
 
+// SigningKey is a private key the OpenID provider signs ID tokens with
+type SigningKey struct {
+	KeyID      string    `json:"kid" gorm:"primaryKey"`
+	Algorithm  string    `json:"alg"`
+	PrivateKey string    `json:"-"` // PEM encoded PKCS #8
+	CreatedAt  time.Time `json:"created_at" gorm:"default:now();index"`
+}
+
+func (sk *SigningKey) TableName() string {
+	return "application.signing_key"
+}
+
+// OAuthConsent records the scope a user granted to a third-party application
+type OAuthConsent struct {
+	UserID        uuid.UUID   `json:"-" gorm:"type:uuid;primaryKey"`
+	Application   Application `json:"application" gorm:"foreignKey:ApplicationID;references:ApplicationID"`
+	ApplicationID string      `json:"-" gorm:"primaryKey"`
+	Scope         string      `json:"scope"` // Space separated scopes the user consented to
+	CreatedAt     time.Time   `json:"created_at" gorm:"default:now()"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+func (oc *OAuthConsent) TableName() string {
+	return "application.oauth_consent"
+}
+
+// MFARecoveryCode is a single use code that replaces a TOTP code when the
+// user lost access to their authenticator
+type MFARecoveryCode struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	UserID    uuid.UUID  `json:"-" gorm:"type:uuid;index"`
+	CodeHash  string     `json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"default:now()"`
+}
+
+func (rc *MFARecoveryCode) TableName() string {
+	return "application.mfa_recovery_code"
+}
+
+// MFAChallenge is handed out after a correct password when the user has MFA
+// enabled, and is exchanged together with a TOTP code for a token
+type MFAChallenge struct {
+	Token     string    `json:"-" gorm:"primaryKey"`
+	UserID    uuid.UUID `json:"-" gorm:"type:uuid;index"`
+	Attempts  int       `json:"-" gorm:"default:0"`
+	CreatedAt time.Time `json:"created_at" gorm:"default:now()"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+func (mc *MFAChallenge) TableName() string {
+	return "application.mfa_challenge"
+}
+
+// Invitation invites someone by email to join an organization. The invitee
+// receives a signed link and sets their own password when accepting.
+type Invitation struct {
+	ID             uuid.UUID    `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+	Email          string       `json:"email"`
+	Organization   Organization `json:"organization"`
+	OrganizationID uuid.UUID    `json:"organization_id" gorm:"type:uuid"`
+	Role           string       `json:"role"`
+	InvitedByID    uuid.UUID    `json:"invited_by_id" gorm:"type:uuid"`
+	CreatedAt      time.Time    `json:"created_at" gorm:"default:now()"`
+	ExpiredAt      time.Time    `json:"expired_at"`
+	AcceptedAt     *time.Time   `json:"accepted_at"`
+}
+
+func (i *Invitation) TableName() string {
+	return "application.invitation"
+}
+
+// UserToken is a single use token sent to the user by email, such as an
+// account unlock link
+type UserToken struct {
+	Token     string     `json:"-" gorm:"primaryKey"` // SHA-256 hash of the token
+	UserID    uuid.UUID  `json:"-" gorm:"type:uuid;index"`
+	Purpose   string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at" gorm:"default:now()"`
+	ExpiredAt time.Time  `json:"expired_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+func (ut *UserToken) TableName() string {
+	return "application.user_token"
+}
+
 type AuthLog struct {
 	LogID      int        `json:"log_id" gorm:"primaryKey"`
-	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid"`
+	UserID     *uuid.UUID `json:"user_id" gorm:"type:uuid"`
 	ActionType string     `json:"action_type"`
 	IPAddress  string     `json:"ip_address"`
 	UserAgent  string     `json:"user_agent"`
@@ -451,29 +569,93 @@ func (rs *RecoverySample) TableName() string {
 type JobStatus string
 
 const (
-	JobStatusPending  JobStatus = "pending"
-	JobStatusRunning  JobStatus = "running"
-	JobStatusComplete JobStatus = "complete"
-	JobStatusFailed   JobStatus = "failed"
-	JobStatusRetry    JobStatus = "retry"
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusComplete  JobStatus = "complete"
+	JobStatusFailed    JobStatus = "failed" // Failed without being retried, such as a job type without handler
+	JobStatusRetry     JobStatus = "retry"
+	JobStatusCancelled JobStatus = "cancelled"
+	JobStatusDead      JobStatus = "dead" // Failed on every attempt allowed by MaxRetries
 )
 
 // WorkerJob represents a background job in the worker queue
 type WorkerJob struct {
-	ID           int64      `json:"id" gorm:"primaryKey;autoIncrement"`
-	JobType      string     `json:"job_type" gorm:"not null;index"`
-	Payload      JSONObject `json:"payload" gorm:"type:jsonb"`
-	Status       JobStatus  `json:"status" gorm:"type:application.job_status;not null;default:'pending';index"`
-	Priority     int        `json:"priority" gorm:"not null;default:0;index:idx_worker_jobs_priority,sort:desc"`
-	RetryCount   int        `json:"retry_count" gorm:"not null;default:0"`
-	MaxRetries   int        `json:"max_retries" gorm:"not null;default:3"`
-	LastError    *string    `json:"last_error"`
-	ProcessAfter *time.Time `json:"process_after" gorm:"index:idx_worker_jobs_status_process_after"`
-	CreatedAt    time.Time  `json:"created_at" gorm:"not null;default:now();index"`
-	UpdatedAt    time.Time  `json:"updated_at" gorm:"not null;default:now()"`
+	ID              int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	JobType         string     `json:"job_type" gorm:"not null;index"`
+	Payload         JSONObject `json:"payload" gorm:"type:jsonb"`
+	Status          JobStatus  `json:"status" gorm:"type:application.job_status;not null;default:'pending';index"`
+	Priority        int        `json:"priority" gorm:"not null;default:0;index:idx_worker_jobs_priority,sort:desc"`
+	RetryCount      int        `json:"retry_count" gorm:"not null;default:0"`
+	MaxRetries      int        `json:"max_retries" gorm:"not null"` // No tag default, it would replace an explicit 0
+	LastError       *string    `json:"last_error"`
+	DedupKey        *string    `json:"dedup_key" gorm:"uniqueIndex:idx_worker_jobs_dedup_key,where:dedup_key IS NOT NULL AND status IN ('pending'\\,'retry'\\,'running')"`
+	Progress        int        `json:"progress" gorm:"not null;default:0"` // Percentage reported by the handler of the running attempt
+	ProgressMessage *string    `json:"progress_message"`
+	Result          JSONObject `json:"result" gorm:"type:jsonb"` // Output of the handler
+	ProcessAfter    *time.Time `json:"process_after" gorm:"index:idx_worker_jobs_status_process_after"`
+	CreatedAt       time.Time  `json:"created_at" gorm:"not null;default:now();index"`
+	UpdatedAt       time.Time  `json:"updated_at" gorm:"not null;default:now()"`
 }
 
 // TableName specifies the database table name for the WorkerJob model
 func (w *WorkerJob) TableName() string {
 	return "application.worker_jobs"
 }
+
+// WorkerSchedule enqueues a worker job every time its cron expression matches
+type WorkerSchedule struct {
+	Name      string     `json:"name" gorm:"primaryKey"`
+	JobType   string     `json:"job_type" gorm:"not null"`
+	Payload   JSONObject `json:"payload" gorm:"type:jsonb"`
+	Cron      string     `json:"cron" gorm:"not null"`                   // Five field cron expression
+	Timezone  string     `json:"timezone" gorm:"not null;default:'UTC'"` // IANA time zone the expression is evaluated in
+	Paused    bool       `json:"paused" gorm:"not null;default:false"`
+	NextRunAt time.Time  `json:"next_run_at" gorm:"not null;index"`
+	LastRunAt *time.Time `json:"last_run_at"`
+	LastJobID *int64     `json:"last_job_id"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null;default:now()"`
+	UpdatedAt time.Time  `json:"updated_at" gorm:"not null;default:now()"`
+}
+
+// TableName specifies the database table name for the WorkerSchedule model
+func (w *WorkerSchedule) TableName() string {
+	return "application.worker_schedules"
+}
+
+// WorkerQueue holds the settings for the jobs of one type. Job types without a
+// queue run without limits.
+type WorkerQueue struct {
+	JobType           string     `json:"job_type" gorm:"primaryKey"`
+	MaxConcurrency    int        `json:"max_concurrency" gorm:"not null;default:0"` // Running jobs across all workers, 0 is unlimited
+	RateLimit         int        `json:"rate_limit" gorm:"not null;default:0"`      // Jobs started per minute, 0 is unlimited
+	DefaultPriority   *int       `json:"default_priority"`
+	DefaultMaxRetries *int       `json:"default_max_retries"`
+	Paused            bool       `json:"paused" gorm:"not null;default:false"`
+	RateWindowStart   *time.Time `json:"-"`
+	RateWindowCount   int        `json:"-" gorm:"not null;default:0"` // Jobs started since RateWindowStart
+	CreatedAt         time.Time  `json:"created_at" gorm:"not null;default:now()"`
+	UpdatedAt         time.Time  `json:"updated_at" gorm:"not null;default:now()"`
+}
+
+// TableName specifies the database table name for the WorkerQueue model
+func (w *WorkerQueue) TableName() string {
+	return "application.worker_queues"
+}
+
+// WorkerJobAttempt records a single run of a worker job
+type WorkerJobAttempt struct {
+	ID         int64      `json:"id" gorm:"primaryKey;autoIncrement"`
+	JobID      int64      `json:"job_id" gorm:"not null;index"`
+	Job        WorkerJob  `json:"-" gorm:"foreignKey:JobID;constraint:OnDelete:CASCADE"`
+	Attempt    int        `json:"attempt" gorm:"not null"` // Starts at 1
+	WorkerID   string     `json:"worker_id"`
+	Status     JobStatus  `json:"status" gorm:"type:application.job_status;not null"` // Running, complete or failed
+	Error      *string    `json:"error"`
+	StartedAt  time.Time  `json:"started_at" gorm:"not null;default:now()"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// TableName specifies the database table name for the WorkerJobAttempt model
+func (w *WorkerJobAttempt) TableName() string {
+	return "application.worker_job_attempts"
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+	"fundermaps/app/platform/apikey"
+)
+
+func GetUserAPIKeys(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	apiKeys, err := apikey.NewService(db).List(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(apiKeys)
+}
+
+// CreateUserAPIKey creates an API key for the current user. The key is only
+// returned in this response.
+func CreateUserAPIKey(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	type APIKeyInput struct {
+		Name      string     `json:"name" validate:"required,max=100"`
+		ExpiredAt *time.Time `json:"expired_at"`
+	}
+
+	var input APIKeyInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	err := config.Validate.Struct(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	if input.ExpiredAt != nil && input.ExpiredAt.Before(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Expiration date must be in the future"})
+	}
+
+	apiKey, err := apikey.NewService(db).Create(user.ID, input.Name, input.ExpiredAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(apiKey)
+}
+
+func RevokeUserAPIKey(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	keyID, err := uuid.Parse(c.Params("key_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid API key ID"})
+	}
+
+	if err := apikey.NewService(db).Revoke(user.ID, keyID); err != nil {
+		if errors.Is(err, apikey.ErrKeyNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "API key not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
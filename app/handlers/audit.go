@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+	"fundermaps/app/platform/audit"
+	puser "fundermaps/app/platform/user"
+)
+
+// Reasons recorded with a failed login
+const (
+	loginFailureUnknownEmail    = "unknown_email"
+	loginFailureInvalidPassword = "invalid_password"
+	loginFailureInvalidMFACode  = "invalid_mfa_code"
+	loginFailureAccountLocked   = "account_locked"
+)
+
+// recordAuthEvent writes an event to the authentication log. Failing to do so
+// does not fail the request.
+func recordAuthEvent(c *fiber.Ctx, db *gorm.DB, userID uuid.UUID, action string, metadata map[string]any) {
+	err := audit.NewService(db).Record(audit.Entry{
+		UserID:    userID,
+		Action:    action,
+		IPAddress: c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Metadata:  metadata,
+	})
+	if err != nil {
+		log.Printf("Failed to record %s: %v", action, err)
+	}
+}
+
+// TODO: Move to platform
+// registerFailedLogin counts a failed attempt against the user and records it.
+// If this attempt locked the account the lockout is recorded as well and the
+// user is sent an unlock link.
+func registerFailedLogin(c *fiber.Ctx, cfg *config.Config, db *gorm.DB, user *database.User, reason string) {
+	recordAuthEvent(c, db, user.ID, audit.ActionLoginFailure, map[string]any{"reason": reason})
+
+	locked, err := puser.NewService(db).RegisterFailedAttempt(user, puser.NewLockoutPolicy(cfg))
+	if err != nil {
+		log.Printf("Failed to register failed attempt of user %s: %v", user.ID, err)
+		return
+	}
+
+	if locked {
+		recordAuthEvent(c, db, user.ID, audit.ActionLockout, map[string]any{
+			"lockout_end":   user.LockoutEnd,
+			"lockout_count": user.LockoutCount,
+		})
+		sendUnlockEmail(cfg, db, user)
+	}
+}
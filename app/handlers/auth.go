@@ -15,87 +15,15 @@ import (
 	"fundermaps/app/config"
 	"fundermaps/app/database"
 	"fundermaps/app/mail"
+	"fundermaps/app/platform/audit"
+	"fundermaps/app/platform/mfa"
+	"fundermaps/app/platform/oauth"
+	"fundermaps/app/platform/organization"
+	"fundermaps/app/platform/token"
 	puser "fundermaps/app/platform/user"
-	"fundermaps/pkg/utils"
+	"fundermaps/pkg/password"
 )
 
-const accessTokenExp = 3600
-const refreshTokenExp = 365
-
-type AuthToken struct {
-	AccessToken  string    `json:"access_token"`
-	TokenType    string    `json:"token_type"`
-	ExpiresIn    int       `json:"expires_in"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	RefreshToken string    `json:"refresh_token"`
-}
-
-type AuthContext struct {
-	db        *gorm.DB
-	ipAddress string
-}
-
-// TODO: Move this to a service
-func (ctx *AuthContext) generateTokens(clientID string, userID uuid.UUID) (AuthToken, error) {
-	const tokenType = "Bearer"
-
-	authAccessToken := database.AuthAccessToken{
-		AccessToken:   fmt.Sprintf("fmat%s", utils.GenerateRandomString(40)),
-		IPAddress:     ctx.ipAddress,
-		ApplicationID: clientID,
-		UserID:        userID,
-		ExpiredAt:     time.Now().Add(accessTokenExp * time.Second),
-	}
-	authRefreshToken := database.AuthRefreshToken{
-		Token:         fmt.Sprintf("fmrt%s", utils.GenerateRandomString(40)),
-		ApplicationID: clientID,
-		UserID:        userID,
-		ExpiredAt:     time.Now().AddDate(0, 0, refreshTokenExp),
-	}
-
-	// TODO: Transaction should be handled by the service
-	ctx.db.Transaction(func(tx *gorm.DB) error {
-		tx.Create(&authAccessToken)
-		tx.Create(&authRefreshToken)
-
-		return nil
-	})
-
-	authToken := AuthToken{
-		AccessToken:  authAccessToken.AccessToken,
-		TokenType:    tokenType,
-		ExpiresIn:    accessTokenExp,
-		ExpiresAt:    authAccessToken.ExpiredAt,
-		RefreshToken: authRefreshToken.Token,
-	}
-	return authToken, nil
-}
-
-// TODO: Move this to a service
-func (ctx *AuthContext) generateTokensFromUser(clientID string, user database.User) (AuthToken, error) {
-	return ctx.generateTokens(clientID, user.ID)
-}
-
-// TODO: Move this to a service
-func (ctx *AuthContext) generateTokensFromAuthCode(authCode database.AuthCode) (AuthToken, error) {
-	return ctx.generateTokens(authCode.ApplicationID, authCode.UserID)
-}
-
-// TODO: Move this to a service
-func (ctx *AuthContext) generateTokensFromRefreshToken(refreshToken database.AuthRefreshToken) (AuthToken, error) {
-	return ctx.generateTokens(refreshToken.ApplicationID, refreshToken.UserID)
-}
-
-// TODO: Move this to a service
-func (ctx *AuthContext) revokeAuthCode(authCode database.AuthCode) error {
-	return ctx.db.Delete(&database.AuthCode{}, "code = ?", authCode.Code).Error
-}
-
-// TODO: Move this to a service
-func (ctx *AuthContext) revokeRefreshToken(refreshToken database.AuthRefreshToken) error {
-	return ctx.db.Delete(&database.AuthRefreshToken{}, "token = ?", refreshToken.Token).Error
-}
-
 func Logout(c *fiber.Ctx) error {
 	store := c.Locals("store").(*session.Store)
 
@@ -110,6 +38,7 @@ func Logout(c *fiber.Ctx) error {
 }
 
 func LoginWithForm(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
 	db := c.Locals("db").(*gorm.DB)
 	store := c.Locals("store").(*session.Store)
 
@@ -145,76 +74,117 @@ func LoginWithForm(c *fiber.Ctx) error {
 	result := db.First(&user, "email = ?", strings.ToLower(email))
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			recordAuthEvent(c, db, uuid.Nil, audit.ActionLoginFailure, map[string]any{"reason": loginFailureUnknownEmail, "email": email})
 			return c.SendStatus(fiber.StatusUnauthorized)
 		}
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
 	if userService.IsLocked(&user) {
+		recordAuthEvent(c, db, user.ID, audit.ActionLoginFailure, map[string]any{"reason": loginFailureAccountLocked})
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	if user.PasswordHash == "" {
+	if !userService.VerifyPassword(&user, password) {
+		registerFailedLogin(c, cfg, db, &user, loginFailureInvalidPassword)
 		return c.SendStatus(fiber.StatusUnauthorized)
-	} else if strings.HasPrefix(user.PasswordHash, "$argon2id$") {
-		if !utils.VerifyPassword(password, user.PasswordHash) {
-			userService.IncrementAccessFailedCount(&user)
-			return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	// End platform service
+
+	loginReq := &loginRequest{
+		ClientID:            c.FormValue("client_id"),
+		RedirectURI:         c.FormValue("redirect_uri"),
+		ResponseType:        c.FormValue("response_type"),
+		State:               c.FormValue("state"),
+		Scope:               c.FormValue("scope"),
+		Nonce:               c.FormValue("nonce"),
+		CodeChallenge:       c.FormValue("code_challenge"),
+		CodeChallengeMethod: c.FormValue("code_challenge_method"),
+	}
+
+	if user.MFAEnabled {
+		mfaToken, err := mfa.NewService(db).CreateChallenge(user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to start MFA challenge")
 		}
-	} else {
-		if !utils.VerifyLegacyPassword(password, user.PasswordHash) {
-			userService.IncrementAccessFailedCount(&user)
-			return c.SendStatus(fiber.StatusUnauthorized)
+
+		if err := saveLoginRequest(sess, mfaToken, loginReq); err != nil {
+			return err
 		}
+		return c.Redirect(MFARedirectURL)
 	}
 
-	db.Exec("UPDATE application.user SET access_failed_count = 0, login_count = login_count + 1, last_login = CURRENT_TIMESTAMP WHERE id = ?", user.ID)
+	recordLogin(c, db, user.ID, "password")
 
-	// End platform service
+	return completeLogin(c, cfg, db, sess, user.ID, loginReq)
+}
 
+// completeLogin marks the session as authenticated and continues the OAuth2
+// flow the login was started from, if any
+func completeLogin(c *fiber.Ctx, cfg *config.Config, db *gorm.DB, sess *session.Session, userID uuid.UUID, loginReq *loginRequest) error {
 	sess.Set("authenticated", true)
-	sess.Set("user_id", user.ID.String())
+	sess.Set("user_id", userID.String())
 	if err := sess.Save(); err != nil {
 		return err
 	}
 
-	clientID := c.FormValue("client_id")
-	redirectURI := c.FormValue("redirect_uri")
-	responseType := c.FormValue("response_type")
-	state := c.FormValue("state")
-	codeChallenge := c.FormValue("code_challenge")
-	codeChallengeMethod := c.FormValue("code_challenge_method")
-
 	// Check if we are dealing with an OAuth2 request
-	if clientID != "" && responseType == "code" {
-		_, err := getClient(db, clientID)
+	if loginReq.ClientID != "" && loginReq.ResponseType == "code" {
+		client, err := getClient(db, loginReq.ClientID)
 		if err != nil {
 			return c.Status(fiber.StatusBadRequest).SendString("Invalid client ID")
 		}
 
-		var authCode string
-		if codeChallengeMethod != "" && codeChallenge != "" {
-			authCode, err = generateAuthCodeWithPKCE(db, clientID, user.ID, codeChallenge, codeChallengeMethod)
-		} else {
-			authCode, err = generateAuthCode(db, clientID, user.ID)
+		resolvedRedirectURI, ok := resolveRedirectURI(client, loginReq.RedirectURI)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid redirect URI")
 		}
+
+		grantedScope, err := oauth.GrantScope(client.Scopes, loginReq.Scope)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to generate authorization code")
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid scope")
 		}
 
-		if redirectURI != "" && state != "" {
-			return c.Redirect(fmt.Sprintf("%s?code=%s&state=%s", redirectURI, authCode, state))
-		} else if redirectURI != "" {
-			return c.Redirect(fmt.Sprintf("%s?code=%s", redirectURI, authCode))
+		authReq := &authorizationRequest{
+			ClientID:            loginReq.ClientID,
+			RedirectURI:         loginReq.RedirectURI,
+			ResolvedRedirectURI: resolvedRedirectURI,
+			State:               loginReq.State,
+			Scope:               grantedScope,
+			Nonce:               loginReq.Nonce,
+			CodeChallenge:       loginReq.CodeChallenge,
+			CodeChallengeMethod: loginReq.CodeChallengeMethod,
 		}
+
+		consent, err := needsConsent(db, cfg, userID, authReq)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to check consent")
+		}
+		if !consent {
+			return completeAuthorization(c, db, userID, authReq)
+		}
+
+		if err := saveAuthorizationRequest(sess, authReq); err != nil {
+			return err
+		}
+		return c.Redirect(ConsentRedirectURL)
 	}
 
-	if redirectURI != "" {
-		return c.Redirect(redirectURI)
+	// Outside an OAuth2 flow only redirect within this host
+	if oauth.IsLocalRedirect(loginReq.RedirectURI) {
+		return c.Redirect(loginReq.RedirectURI)
 	}
 	return c.Redirect("/")
 }
 
+// TODO: Move to platform
+func recordLogin(c *fiber.Ctx, db *gorm.DB, userID uuid.UUID, method string) {
+	db.Exec("UPDATE application.user SET access_failed_count = 0, lockout_count = 0, login_count = login_count + 1, last_login = CURRENT_TIMESTAMP WHERE id = ?", userID)
+
+	recordAuthEvent(c, db, userID, audit.ActionLoginSuccess, map[string]any{"method": method})
+}
+
 func SigninWithPassword(c *fiber.Ctx) error {
 	cfg := c.Locals("config").(*config.Config)
 	db := c.Locals("db").(*gorm.DB)
@@ -222,8 +192,9 @@ func SigninWithPassword(c *fiber.Ctx) error {
 	userService := puser.NewService(db)
 
 	type LoginInput struct {
-		Email    string `json:"email" validate:"required,email"`
-		Password string `json:"password" validate:"required"`
+		Email          string `json:"email" validate:"required,email"`
+		Password       string `json:"password" validate:"required"`
+		OrganizationID string `json:"organization_id" validate:"omitempty,uuid"`
 	}
 
 	var input LoginInput
@@ -242,39 +213,99 @@ func SigninWithPassword(c *fiber.Ctx) error {
 	result := db.First(&user, "email = ?", strings.ToLower(input.Email))
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			recordAuthEvent(c, db, uuid.Nil, audit.ActionLoginFailure, map[string]any{"reason": loginFailureUnknownEmail, "email": input.Email})
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid credentials"})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	if userService.IsLocked(&user) {
+		recordAuthEvent(c, db, user.ID, audit.ActionLoginFailure, map[string]any{"reason": loginFailureAccountLocked})
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "account_locked"})
 	}
 
-	if user.PasswordHash == "" {
+	if !userService.VerifyPassword(&user, input.Password) {
+		registerFailedLogin(c, cfg, db, &user, loginFailureInvalidPassword)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid credentials"})
-	} else if strings.HasPrefix(user.PasswordHash, "$argon2id$") {
-		if !utils.VerifyPassword(input.Password, user.PasswordHash) {
-			userService.IncrementAccessFailedCount(&user)
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid credentials"})
+	}
+
+	// End platform service
+
+	if user.MFAEnabled {
+		mfaToken, err := mfa.NewService(db).CreateChallenge(user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 		}
-	} else {
-		if !utils.VerifyLegacyPassword(input.Password, user.PasswordHash) {
-			userService.IncrementAccessFailedCount(&user)
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid credentials"})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "mfa_required", "mfa_token": mfaToken})
+	}
+
+	recordLogin(c, db, user.ID, "password")
+
+	return issueSigninToken(c, cfg, db, &user, input.OrganizationID)
+}
+
+// SigninWithMFA completes a sign in that was answered with mfa_required by
+// exchanging the MFA token and a TOTP or recovery code for a token
+func SigninWithMFA(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+	db := c.Locals("db").(*gorm.DB)
+
+	userService := puser.NewService(db)
+
+	type MFAInput struct {
+		MFAToken       string `json:"mfa_token" validate:"required"`
+		Code           string `json:"code" validate:"required"`
+		OrganizationID string `json:"organization_id" validate:"omitempty,uuid"`
+	}
+
+	var input MFAInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	err := config.Validate.Struct(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	user, err := mfa.NewService(db).VerifyChallenge(input.MFAToken, input.Code)
+	if err != nil {
+		if errors.Is(err, mfa.ErrInvalidChallenge) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid or expired MFA token"})
+		}
+		if errors.Is(err, mfa.ErrInvalidCode) {
+			registerFailedLogin(c, cfg, db, user, loginFailureInvalidMFACode)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid MFA code"})
 		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	if userService.IsLocked(user) {
+		recordAuthEvent(c, db, user.ID, audit.ActionLoginFailure, map[string]any{"reason": loginFailureAccountLocked})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "account_locked"})
 	}
 
-	db.Exec("UPDATE application.user SET access_failed_count = 0, login_count = login_count + 1, last_login = CURRENT_TIMESTAMP WHERE id = ?", user.ID)
+	recordLogin(c, db, user.ID, "mfa")
 
-	// End platform service
+	return issueSigninToken(c, cfg, db, user, input.OrganizationID)
+}
 
-	ctx := AuthContext{db: db, ipAddress: c.IP()}
-	authToken, err := ctx.generateTokensFromUser(cfg.ApplicationID, user)
+func issueSigninToken(c *fiber.Ctx, cfg *config.Config, db *gorm.DB, user *database.User, organizationID string) error {
+	boundOrganizationID, err := tokenOrganization(db, user.ID, organizationID)
 	if err != nil {
+		if errors.Is(err, organization.ErrNotMember) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Not a member of this organization"})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
-	if err := revokeAPIKey(db, user); err != nil {
+
+	tokenService := token.NewService(db)
+	authToken, err := tokenService.Issue(cfg.ApplicationID, user.ID, boundOrganizationID, oauth.ScopeUnrestricted, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+	// Signing in cancels a pending password reset
+	if err := puser.NewService(db).RevokeTokens(user.ID, puser.TokenPurposePasswordReset); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
@@ -301,9 +332,12 @@ func RefreshToken(c *fiber.Ctx) error {
 
 	// TODO: From this point on, move into a platform service
 
-	refreshToken, err := getRefreshToken(db, cfg.ApplicationID, input.RefreshToken)
+	refreshToken, err := getRefreshToken(c, db, cfg.ApplicationID, input.RefreshToken)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid credentials"})
+		if errors.Is(err, token.ErrInvalidRefreshToken) || errors.Is(err, token.ErrRefreshTokenReused) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid credentials"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	var user database.User
@@ -315,32 +349,28 @@ func RefreshToken(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
-	if user.AccessFailedCount >= 5 {
+	if puser.NewService(db).IsLocked(&user) {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Account locked"})
 	}
 
-	ctx := AuthContext{db: db, ipAddress: c.IP()}
-	authToken, err := ctx.generateTokensFromRefreshToken(refreshToken)
+	authToken, err := rotateRefreshToken(c, db, refreshToken)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
-	}
-	if err := ctx.revokeRefreshToken(refreshToken); err != nil {
+		if errors.Is(err, token.ErrRefreshTokenReused) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid credentials"})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
-	// if err := revokeAPIKey(db, user); err != nil {
-	// 	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
-	// }
+	recordAuthEvent(c, db, user.ID, audit.ActionTokenRefresh, map[string]any{"application_id": refreshToken.ApplicationID})
 
 	return c.JSON(authToken)
 }
 
 func ChangePassword(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
 	db := c.Locals("db").(*gorm.DB)
 	user := c.Locals("user").(database.User)
 
-	userService := puser.NewService(db)
-
 	type ChangePasswordInput struct {
 		CurrentPassword string `json:"current_password" validate:"required"`
 		NewPassword     string `json:"new_password" validate:"required,min=6"`
@@ -358,24 +388,15 @@ func ChangePassword(c *fiber.Ctx) error {
 
 	// TODO: From this point on, move into a platform service
 
-	if userService.IsLocked(&user) {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "account_locked"})
+	if ok, err := verifyCurrentPassword(c, cfg, db, &user, input.CurrentPassword); !ok {
+		return err
 	}
 
-	if strings.HasPrefix(user.PasswordHash, "$argon2id$") {
-		if !utils.VerifyPassword(input.CurrentPassword, user.PasswordHash) {
-			userService.IncrementAccessFailedCount(&user)
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid credentials"})
-		}
-	} else {
-		if !utils.VerifyLegacyPassword(input.CurrentPassword, user.PasswordHash) {
-			userService.IncrementAccessFailedCount(&user)
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid credentials"})
-		}
+	hash, err := password.Hash(input.NewPassword)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
 	}
 
-	hash := utils.HashLegacyPassword(input.NewPassword)
-
 	err = db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Model(&user).Updates(map[string]any{
 			"password_hash":       hash,
@@ -386,20 +407,40 @@ func ChangePassword(c *fiber.Ctx) error {
 			return err
 		}
 
-		if err := tx.Where("user_id = ?", user.ID).Delete(&database.ResetKey{}).Error; err != nil {
-			return err
-		}
-
-		return nil
+		return puser.NewService(tx).RevokeTokens(user.ID, puser.TokenPurposePasswordReset)
 	})
 
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
 	}
 
+	recordAuthEvent(c, db, user.ID, audit.ActionPasswordChange, nil)
+
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// verifyCurrentPassword confirms the current password of the user before a
+// change to their credentials. If it returns false the error response has
+// been sent.
+func verifyCurrentPassword(c *fiber.Ctx, cfg *config.Config, db *gorm.DB, user *database.User, currentPassword string) (bool, error) {
+	userService := puser.NewService(db)
+
+	if userService.IsLocked(user) {
+		return false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "account_locked"})
+	}
+
+	if !userService.VerifyPassword(user, currentPassword) {
+		registerFailedLogin(c, cfg, db, user, loginFailureInvalidPassword)
+		return false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid credentials"})
+	}
+
+	return true, nil
+}
+
+const ResetTokenExpiration = time.Hour
+
+// ForgotPassword mails a password reset token. The response is the same
+// whether or not an account exists for the email.
 func ForgotPassword(c *fiber.Ctx) error {
 	cfg := c.Locals("config").(*config.Config)
 	db := c.Locals("db").(*gorm.DB)
@@ -420,27 +461,22 @@ func ForgotPassword(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
 	}
 
-	user, err := userService.GetUserByEmail(input.Email)
+	user, err := userService.GetUserByEmail(strings.ToLower(input.Email))
 	if err != nil {
-		if errors.Is(err, errors.New("user not found")) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_email"})
+		if errors.Is(err, puser.ErrUserNotFound) {
+			recordAuthEvent(c, db, uuid.Nil, audit.ActionPasswordResetRequest, map[string]any{"email": input.Email})
+			return c.SendStatus(fiber.StatusNoContent)
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
 	}
 
-	if userService.IsLocked(user) {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "account_locked"})
-	}
-
-	resetKey := database.ResetKey{
-		Key:    uuid.New(),
-		UserID: user.ID,
-	}
-
-	if err := db.Create(&resetKey).Error; err != nil {
+	resetToken, err := userService.CreateToken(user.ID, puser.TokenPurposePasswordReset, ResetTokenExpiration)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
 	}
 
+	recordAuthEvent(c, db, user.ID, audit.ActionPasswordResetRequest, nil)
+
 	message := mail.Email{
 		Subject:  "FunderMaps - Wachtwoord reset",
 		From:     fmt.Sprintf("Fundermaps <no-reply@%s>", cfg.MailgunDomain),
@@ -448,23 +484,28 @@ func ForgotPassword(c *fiber.Ctx) error {
 		Template: "reset-password",
 		TemplateVars: map[string]any{
 			"creatorName": user.Email, // TODO: Get the user's name
-			"resetToken":  resetKey.Key,
+			"resetToken":  resetToken,
 		},
 	}
 
-	mailer := mail.NewMailer(cfg.MailgunDomain, cfg.MailgunAPIKey, cfg.MailgunAPIBase)
-	if err := mailer.SendTemplatedMail(&message); err != nil {
-		log.Printf("Failed to send email notification: %v\n", err)
-	}
+	// Send in the background so the response time does not reveal whether the
+	// account exists
+	go func() {
+		mailer := mail.NewMailer(cfg.MailgunDomain, cfg.MailgunAPIKey, cfg.MailgunAPIBase)
+		if err := mailer.SendTemplatedMail(&message); err != nil {
+			log.Printf("Failed to send email notification: %v\n", err)
+		}
+	}()
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// ResetPassword sets a new password with a token from ForgotPassword. The
+// token can be used once. Afterwards the user is signed out everywhere and a
+// lockout is lifted, since the user proved access to their email.
 func ResetPassword(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 
-	userService := puser.NewService(db)
-
 	type ResetPasswordInput struct {
 		ResetKey    string `json:"reset_key" validate:"required"`
 		NewPassword string `json:"new_password" validate:"required,min=6"`
@@ -480,49 +521,44 @@ func ResetPassword(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
 	}
 
-	var resetKey database.ResetKey
-	result := db.First(&resetKey, "key = ?", input.ResetKey) // TODO: Add expiration date check
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_reset_key"})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
-	}
-
-	user, err := userService.GetUserByID(resetKey.UserID)
+	hash, err := password.Hash(input.NewPassword)
 	if err != nil {
-		if errors.Is(err, errors.New("user not found")) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_reset_key"})
-		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
 	}
 
-	if userService.IsLocked(user) {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "account_locked"})
-	}
-
-	hash := utils.HashLegacyPassword(input.NewPassword)
-
+	// The token is only used up if the password is changed and the sessions
+	// are revoked as well
+	var user *database.User
 	err = db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Model(&user).Updates(map[string]any{
+		var err error
+		user, err = puser.NewService(tx).ConsumeToken(input.ResetKey, puser.TokenPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(user).Updates(map[string]any{
 			"password_hash":       hash,
 			"access_failed_count": 0,
-			"login_count":         gorm.Expr("login_count + ?", 1),
-			"last_login":          time.Now(),
+			"lockout_end":         nil,
+			"lockout_count":       0,
 		}).Error; err != nil {
 			return err
 		}
 
-		if err := tx.Where("user_id = ?", user.ID).Delete(&database.ResetKey{}).Error; err != nil {
+		if err := puser.NewService(tx).RevokeTokens(user.ID, puser.TokenPurposePasswordReset); err != nil {
 			return err
 		}
 
-		return nil
+		return token.NewService(tx).RevokeAll(user.ID)
 	})
-
 	if err != nil {
+		if errors.Is(err, puser.ErrInvalidToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_reset_key"})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
 	}
 
+	recordAuthEvent(c, db, user.ID, audit.ActionPasswordReset, nil)
+
 	return c.SendStatus(fiber.StatusNoContent)
 }
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+	"fundermaps/app/platform/oauth"
+	"fundermaps/app/platform/token"
+	"fundermaps/pkg/utils"
+)
+
+const (
+	ConsentRedirectURL = "/auth/consent"
+
+	sessionAuthorizationRequest = "authorization_request"
+	sessionConsentCSRF          = "consent_csrf"
+)
+
+// authorizationRequest is a validated OAuth2 authorization request. It is kept
+// in the session while the user is asked for consent.
+type authorizationRequest struct {
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"` // As given by the client, may be empty
+	ResolvedRedirectURI string `json:"resolved_redirect_uri"`
+	State               string `json:"state"`
+	Scope               string `json:"scope"` // Granted scope
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// TODO: Move to platform
+// needsConsent reports whether the user must approve the authorization
+// request. The first-party application never asks for consent.
+func needsConsent(db *gorm.DB, cfg *config.Config, userID uuid.UUID, authReq *authorizationRequest) (bool, error) {
+	if authReq.ClientID == cfg.ApplicationID {
+		return false, nil
+	}
+
+	var consent database.OAuthConsent
+	result := db.First(&consent, "user_id = ? AND application_id = ?", userID, authReq.ClientID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return true, nil
+		}
+		return false, result.Error
+	}
+
+	return !oauth.CoversScope(consent.Scope, authReq.Scope), nil
+}
+
+// TODO: Move to platform
+func grantConsent(db *gorm.DB, userID uuid.UUID, applicationID string, scope string) error {
+	var consent database.OAuthConsent
+	result := db.First(&consent, "user_id = ? AND application_id = ?", userID, applicationID)
+	if result.Error != nil {
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+
+		return db.Create(&database.OAuthConsent{
+			UserID:        userID,
+			ApplicationID: applicationID,
+			Scope:         scope,
+		}).Error
+	}
+
+	return db.Model(&consent).Update("scope", oauth.MergeScope(consent.Scope, scope)).Error
+}
+
+// completeAuthorization issues an authorization code and sends the user back
+// to the client
+func completeAuthorization(c *fiber.Ctx, db *gorm.DB, userID uuid.UUID, authReq *authorizationRequest) error {
+	authCode := database.AuthCode{
+		ApplicationID: authReq.ClientID,
+		UserID:        userID,
+		Scope:         authReq.Scope,
+		Nonce:         authReq.Nonce,
+		RedirectURI:   authReq.RedirectURI,
+	}
+	if authReq.CodeChallengeMethod != "" && authReq.CodeChallenge != "" {
+		authCode.CodeChallenge = authReq.CodeChallenge
+		authCode.CodeChallengeMethod = authReq.CodeChallengeMethod
+	}
+
+	code, err := generateAuthCode(db, authCode)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to generate authorization code")
+	}
+
+	return redirectToClient(c, authReq, url.Values{"code": {code}})
+}
+
+// redirectToClient sends the user back to the redirect URI of the client with
+// the parameters and the state of the request added to its query
+func redirectToClient(c *fiber.Ctx, authReq *authorizationRequest, params url.Values) error {
+	u, err := url.Parse(authReq.ResolvedRedirectURI)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid redirect URI")
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if authReq.State != "" {
+		query.Set("state", authReq.State)
+	}
+	u.RawQuery = query.Encode()
+
+	return c.Redirect(u.String())
+}
+
+func saveAuthorizationRequest(sess *session.Session, authReq *authorizationRequest) error {
+	data, err := json.Marshal(authReq)
+	if err != nil {
+		return err
+	}
+
+	sess.Set(sessionAuthorizationRequest, string(data))
+	return sess.Save()
+}
+
+func getAuthorizationRequest(sess *session.Session) (*authorizationRequest, bool) {
+	data, ok := sess.Get(sessionAuthorizationRequest).(string)
+	if !ok {
+		return nil, false
+	}
+
+	var authReq authorizationRequest
+	if err := json.Unmarshal([]byte(data), &authReq); err != nil {
+		return nil, false
+	}
+	return &authReq, true
+}
+
+type consentScope struct {
+	Name        string
+	Description string
+}
+
+type consentPage struct {
+	ApplicationName string
+	Scopes          []consentScope
+	CSRFToken       string
+}
+
+// GetConsent renders the consent page for the pending authorization request
+func GetConsent(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	store := c.Locals("store").(*session.Store)
+
+	sess, err := store.Get(c)
+	if err != nil {
+		return err
+	}
+
+	if sess.Get("authenticated") == nil {
+		return c.Redirect(LoginRedirectURL)
+	}
+
+	authReq, ok := getAuthorizationRequest(sess)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).SendString("No pending authorization request")
+	}
+
+	client, err := getClient(db, authReq.ClientID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid client ID")
+	}
+
+	csrfToken := utils.GenerateRandomString(32)
+	sess.Set(sessionConsentCSRF, csrfToken)
+	if err := sess.Save(); err != nil {
+		return err
+	}
+
+	page := consentPage{
+		ApplicationName: client.Name,
+		CSRFToken:       csrfToken,
+	}
+	for _, scope := range oauth.ParseScope(authReq.Scope) {
+		page.Scopes = append(page.Scopes, consentScope{
+			Name:        scope,
+			Description: oauth.ScopeDescriptions[scope],
+		})
+	}
+
+	tmpl, err := template.ParseFiles("./public/consent.html")
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Type("html")
+	return tmpl.Execute(c, page)
+}
+
+// PostConsent handles the user's decision on the consent page. An approved
+// request is remembered so the user is not asked again for the same scope.
+func PostConsent(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	store := c.Locals("store").(*session.Store)
+
+	sess, err := store.Get(c)
+	if err != nil {
+		return err
+	}
+
+	if sess.Get("authenticated") == nil {
+		return c.Redirect(LoginRedirectURL)
+	}
+
+	userID, err := uuid.Parse(sess.Get("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to parse user ID")
+	}
+
+	csrfToken, _ := sess.Get(sessionConsentCSRF).(string)
+	if csrfToken == "" || subtle.ConstantTimeCompare([]byte(csrfToken), []byte(c.FormValue("csrf_token"))) != 1 {
+		return c.Status(fiber.StatusForbidden).SendString("Invalid CSRF token")
+	}
+
+	authReq, ok := getAuthorizationRequest(sess)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).SendString("No pending authorization request")
+	}
+
+	sess.Delete(sessionAuthorizationRequest)
+	sess.Delete(sessionConsentCSRF)
+	if err := sess.Save(); err != nil {
+		return err
+	}
+
+	if c.FormValue("action") != "approve" {
+		return redirectToClient(c, authReq, url.Values{"error": {"access_denied"}})
+	}
+
+	if err := grantConsent(db, userID, authReq.ClientID, authReq.Scope); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to save consent")
+	}
+
+	return completeAuthorization(c, db, userID, authReq)
+}
+
+func GetUserConsents(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	var consents []database.OAuthConsent
+	result := db.Preload("Application").
+		Where("user_id = ?", user.ID).
+		Order("created_at DESC").
+		Find(&consents)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(consents)
+}
+
+// RevokeUserConsent removes the user's consent for an application and revokes
+// all tokens the application holds for the user
+func RevokeUserConsent(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	applicationID := c.Params("application_id")
+
+	result := db.Delete(&database.OAuthConsent{}, "user_id = ? AND application_id = ?", user.ID, applicationID)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Consent not found"})
+	}
+
+	if err := token.NewService(db).RevokeApplication(user.ID, applicationID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
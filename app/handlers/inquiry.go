@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -29,9 +30,16 @@ type CreateInquiryInput struct {
 	StandardF3O           bool      `json:"standard_f3o"`
 }
 
+// UpdateAuditStatusInput holds a new report.audit_status for an inquiry or
+// recovery
+type UpdateAuditStatusInput struct {
+	AuditStatus string `json:"audit_status" validate:"required,oneof=todo pending done discarded pending_review rejected"`
+}
+
 func CreateInquiry(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 	user := c.Locals("user").(database.User) // TODO: Create a function to get the user from the context
+	organizationID := c.Locals("organization_id").(uuid.UUID)
 
 	var input CreateInquiryInput
 	if err := c.BodyParser(&input); err != nil {
@@ -66,7 +74,7 @@ func CreateInquiry(c *fiber.Ctx) error {
 		attribution := database.Attribution{
 			Reviewer:   input.AttributionReviewer,
 			Creator:    user.ID,
-			Owner:      user.Organizations[0].ID, // TODO: handle multiple organizations
+			Owner:      organizationID,
 			Contractor: input.AttributionContractor,
 		}
 		if err := tx.Create(&attribution).Error; err != nil {
@@ -104,6 +112,7 @@ func CreateInquiry(c *fiber.Ctx) error {
 
 func CreateInquirySample(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
+	organizationID := c.Locals("organization_id").(uuid.UUID)
 
 	inquiryIdStr := c.Params("inquiry_id")
 	inquiryId, err := strconv.Atoi(inquiryIdStr)
@@ -111,6 +120,16 @@ func CreateInquirySample(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid inquiry_id format", "error": err.Error()})
 	}
 
+	var inquiry database.Inquiry
+	result := db.Select("id").
+		First(&inquiry, "id = ? AND attribution IN (SELECT id FROM application.attribution WHERE owner = ?)", inquiryId, organizationID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Inquiry not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to load inquiry record", "error": result.Error.Error()})
+	}
+
 	var input database.InquirySample
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Cannot parse JSON", "error": err.Error()})
@@ -139,3 +158,35 @@ func CreateInquirySample(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": input.ID})
 }
+
+// UpdateInquiryStatus changes the audit status of a inquiry owned by the organization
+func UpdateInquiryStatus(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	organizationID := c.Locals("organization_id").(uuid.UUID)
+
+	inquiryID, err := strconv.Atoi(c.Params("inquiry_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid inquiry_id format", "error": err.Error()})
+	}
+
+	var input UpdateAuditStatusInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Cannot parse JSON", "error": err.Error()})
+	}
+
+	if err := config.Validate.Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	result := db.Model(&database.Inquiry{}).
+		Where("id = ? AND attribution IN (SELECT id FROM application.attribution WHERE owner = ?)", inquiryID, organizationID).
+		Updates(map[string]any{"audit_status": input.AuditStatus, "update_date": time.Now()})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to update inquiry record", "error": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Inquiry not found"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+	"fundermaps/app/platform/invite"
+	"fundermaps/app/platform/organization"
+)
+
+// InviteOrganizationUser lets a superuser of the organization invite someone
+// by email
+func InviteOrganizationUser(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+	organizationID := c.Locals("organization_id").(uuid.UUID)
+
+	type InviteInput struct {
+		Email string `json:"email" validate:"required,email"`
+		Role  string `json:"role" validate:"omitempty,oneof=reader writer verifier superuser"`
+	}
+
+	var input InviteInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	err := config.Validate.Struct(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	if input.Role == "" {
+		input.Role = organization.RoleReader
+	}
+
+	invitation, err := invite.NewService(db, cfg).Invite(input.Email, organizationID, input.Role, &user)
+	if err != nil {
+		if errors.Is(err, invite.ErrAlreadyMember) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User is already a member of this organization"})
+		}
+		if errors.Is(err, invite.ErrDeletedUser) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Email belongs to a deleted user"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(invitation)
+}
+
+// GetInvitation shows the invitee what they are invited to before accepting
+func GetInvitation(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+	db := c.Locals("db").(*gorm.DB)
+
+	invitation, err := invite.NewService(db, cfg).Get(c.Query("token"))
+	if err != nil {
+		if errors.Is(err, invite.ErrInvalidInvitation) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Invitation not found or expired"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	var count int64
+	if err := db.Model(&database.User{}).Where("email = ?", invitation.Email).Count(&count).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(fiber.Map{
+		"email":             invitation.Email,
+		"organization_id":   invitation.OrganizationID,
+		"organization_name": invitation.Organization.Name,
+		"role":              invitation.Role,
+		"expired_at":        invitation.ExpiredAt,
+		"existing_user":     count > 0,
+	})
+}
+
+// AcceptInvitation adds the invitee to the organization. New users choose
+// their password here.
+func AcceptInvitation(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+	db := c.Locals("db").(*gorm.DB)
+
+	type AcceptInput struct {
+		Token      string  `json:"token" validate:"required"`
+		Password   string  `json:"password" validate:"omitempty,min=6"`
+		GivenName  *string `json:"given_name"`
+		FamilyName *string `json:"family_name"`
+	}
+
+	var input AcceptInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	err := config.Validate.Struct(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	_, err = invite.NewService(db, cfg).Accept(input.Token, invite.AcceptInput{
+		Password:   input.Password,
+		GivenName:  input.GivenName,
+		FamilyName: input.FamilyName,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, invite.ErrInvalidInvitation):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Invitation not found or expired"})
+		case errors.Is(err, invite.ErrPasswordRequired):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Password is required"})
+		case errors.Is(err, invite.ErrDeletedUser):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Email belongs to a deleted user"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
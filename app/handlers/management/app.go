@@ -3,6 +3,7 @@ package mngmt
 import (
 	"fundermaps/app/config"
 	"fundermaps/app/database"
+	"fundermaps/app/platform/oauth"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -27,7 +28,8 @@ func CreateApplication(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 
 	type ApplicationInput struct {
-		Name string `json:"name" validate:"required"`
+		Name   string   `json:"name" validate:"required"`
+		Scopes []string `json:"scopes"`
 	}
 
 	var input ApplicationInput
@@ -40,8 +42,13 @@ func CreateApplication(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
 	}
 
+	if err := oauth.ValidateScopes(input.Scopes); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid scope"})
+	}
+
 	app := database.Application{
-		Name: input.Name,
+		Name:   input.Name,
+		Scopes: input.Scopes,
 	}
 
 	result := db.Create(&app)
@@ -71,11 +78,13 @@ func UpdateApplication(c *fiber.Ctx) error {
 	}
 
 	type ApplicationInput struct {
-		Name        string              `json:"name" validate:"required"`
-		Data        database.JSONObject `json:"data"`
-		RedirectURL string              `json:"redirect_url"`
-		Public      bool                `json:"public"`
-		UserID      uuid.UUID           `json:"user_id"`
+		Name         string              `json:"name" validate:"required"`
+		Data         database.JSONObject `json:"data"`
+		RedirectURL  string              `json:"redirect_url"`
+		RedirectURLs []string            `json:"redirect_urls" validate:"dive,url"`
+		Public       bool                `json:"public"`
+		UserID       uuid.UUID           `json:"user_id"`
+		Scopes       []string            `json:"scopes"`
 	}
 
 	var input ApplicationInput
@@ -88,11 +97,17 @@ func UpdateApplication(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
 	}
 
+	if err := oauth.ValidateScopes(input.Scopes); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid scope"})
+	}
+
 	app.Name = input.Name
 	app.Data = input.Data
 	app.RedirectURL = input.RedirectURL
+	app.RedirectURLs = input.RedirectURLs
 	app.Public = input.Public
 	app.UserID = input.UserID
+	app.Scopes = input.Scopes
 
 	result = db.Save(&app)
 	if result.Error != nil {
@@ -0,0 +1,57 @@
+package mngmt
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/platform/audit"
+)
+
+// GetAuthLogs retrieves the authentication log with optional filtering. The
+// total number of matching events is returned in the X-Total-Count header.
+func GetAuthLogs(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+
+	options := audit.QueryOptions{
+		Action:    c.Query("action"),
+		IPAddress: c.Query("ip_address"),
+		Limit:     c.QueryInt("limit", 100),
+		Offset:    c.QueryInt("offset", 0),
+	}
+
+	if userID := c.Query("user_id"); userID != "" {
+		uid, err := uuid.Parse(userID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+		}
+		options.UserID = uid
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid from date"})
+		}
+		options.From = t
+	}
+
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid to date"})
+		}
+		options.To = t
+	}
+
+	logs, total, err := audit.NewService(db).Query(options)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	c.Set("X-Total-Count", strconv.FormatInt(total, 10))
+	return c.JSON(logs)
+}
@@ -1,10 +1,19 @@
 package mngmt
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
 	"fundermaps/app/config"
+	"fundermaps/app/database"
 	"fundermaps/app/platform/job"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 	"gorm.io/gorm"
 )
 
@@ -26,14 +35,22 @@ func CreateJob(c *fiber.Ctx) error {
 	}
 
 	// Create the job using the service
-	createdJob, err := jobService.CreateJob(input)
+	createdJob, created, err := jobService.CreateJob(input)
 	if err != nil {
+		if errors.Is(err, job.ErrDuplicateJob) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to create job",
 			"error":   err.Error(),
 		})
 	}
 
+	// A duplicate returns the job that already has the dedup key
+	if !created {
+		return c.Status(fiber.StatusOK).JSON(createdJob)
+	}
+
 	return c.Status(fiber.StatusCreated).JSON(createdJob)
 }
 
@@ -80,7 +97,97 @@ func GetJob(c *fiber.Ctx) error {
 	return c.JSON(job)
 }
 
-// CancelJob cancels a job by changing its status to failed
+const (
+	jobEventsPollInterval = time.Second
+	jobEventsKeepAlive    = 15 * time.Second
+	jobEventsMaxDuration  = time.Hour
+)
+
+// jobState is the part of a job that triggers an event when it changes
+type jobState struct {
+	Status          database.JobStatus
+	Progress        int
+	ProgressMessage string
+	RetryCount      int
+}
+
+func stateOf(j *database.WorkerJob) jobState {
+	state := jobState{Status: j.Status, Progress: j.Progress, RetryCount: j.RetryCount}
+	if j.ProgressMessage != nil {
+		state.ProgressMessage = *j.ProgressMessage
+	}
+	return state
+}
+
+// StreamJobEvents streams a job as Server-Sent Events. A "job" event with the
+// job is sent on connect and whenever its status or progress changes. The
+// stream ends when the job is finished.
+func StreamJobEvents(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	cfg := c.Locals("config").(*config.Config)
+
+	jobService := job.NewService(db, cfg)
+	// The stream writer runs after the handler returns, when the parameter
+	// buffer may have been reused
+	jobID := utils.CopyString(c.Params("id"))
+
+	current, err := jobService.GetJobByID(jobID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Job not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		deadline := time.Now().Add(jobEventsMaxDuration)
+		lastSentAt := time.Now()
+		var lastState *jobState
+
+		for {
+			state := stateOf(current)
+			if lastState == nil || state != *lastState {
+				data, err := json.Marshal(current)
+				if err != nil {
+					return
+				}
+				fmt.Fprintf(w, "event: job\ndata: %s\n\n", data)
+				lastState = &state
+				lastSentAt = time.Now()
+			} else if time.Since(lastSentAt) >= jobEventsKeepAlive {
+				fmt.Fprint(w, ": keep-alive\n\n")
+				lastSentAt = time.Now()
+			}
+
+			// Flushing fails once the client has gone away
+			if err := w.Flush(); err != nil {
+				return
+			}
+
+			if slices.Contains(job.FinishedStatuses, current.Status) || time.Now().After(deadline) {
+				return
+			}
+
+			time.Sleep(jobEventsPollInterval)
+
+			current, err = jobService.GetJobByID(jobID)
+			if err != nil {
+				fmt.Fprint(w, "event: error\ndata: {\"message\":\"Failed to load job\"}\n\n")
+				w.Flush()
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// CancelJob cancels a pending or retrying job
 func CancelJob(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 	cfg := c.Locals("config").(*config.Config)
@@ -88,12 +195,12 @@ func CancelJob(c *fiber.Ctx) error {
 	jobService := job.NewService(db, cfg)
 	jobID := c.Params("id")
 
-	job, err := jobService.CancelJob(jobID)
+	cancelledJob, err := jobService.CancelJob(jobID)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Job not found"})
 		}
-		if err == gorm.ErrInvalidValue {
+		if errors.Is(err, job.ErrJobNotCancellable) {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"message": "Cannot cancel job that is not in pending or retry status",
 			})
@@ -104,5 +211,113 @@ func CancelJob(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.JSON(job)
+	return c.JSON(cancelledJob)
+}
+
+// RetryJob requeues a dead or failed job
+func RetryJob(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	cfg := c.Locals("config").(*config.Config)
+
+	jobService := job.NewService(db, cfg)
+	jobID := c.Params("id")
+
+	requeuedJob, err := jobService.RequeueJob(jobID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Job not found"})
+		}
+		if errors.Is(err, job.ErrJobNotRetryable) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Cannot retry job that is not in dead or failed status",
+			})
+		}
+		if errors.Is(err, job.ErrDuplicateJob) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(requeuedJob)
+}
+
+// GetJobAttempts retrieves the attempt history of a job
+func GetJobAttempts(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	cfg := c.Locals("config").(*config.Config)
+
+	jobService := job.NewService(db, cfg)
+	jobID := c.Params("id")
+
+	if _, err := jobService.GetJobByID(jobID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Job not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	attempts, err := jobService.GetAttempts(jobID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(attempts)
+}
+
+// RetryJobs requeues all dead or failed jobs, optionally of one job type
+func RetryJobs(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	cfg := c.Locals("config").(*config.Config)
+
+	jobService := job.NewService(db, cfg)
+
+	type RetryJobsInput struct {
+		JobType string `json:"job_type"`
+		Status  string `json:"status" validate:"omitempty,oneof=dead failed"`
+	}
+
+	var input RetryJobsInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	if err := config.Validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	if input.Status == "" {
+		input.Status = string(database.JobStatusDead)
+	}
+
+	count, err := jobService.RequeueJobs(input.JobType, database.JobStatus(input.Status))
+	if err != nil {
+		if errors.Is(err, job.ErrDuplicateJob) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(fiber.Map{"count": count})
+}
+
+// PurgeJobs deletes finished jobs by status, optionally of one job type
+func PurgeJobs(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	cfg := c.Locals("config").(*config.Config)
+
+	jobService := job.NewService(db, cfg)
+
+	status := database.JobStatus(c.Query("status"))
+	if !slices.Contains(job.FinishedStatuses, status) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Status must be one of complete, failed, cancelled or dead",
+		})
+	}
+
+	count, err := jobService.PurgeJobs(c.Query("job_type"), status)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(fiber.Map{"count": count})
 }
@@ -1,27 +1,46 @@
 package mngmt
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 
 	"fundermaps/app/config"
 	"fundermaps/app/database"
+	"fundermaps/app/platform/invite"
+	"fundermaps/app/platform/organization"
 	"fundermaps/pkg/utils"
 )
 
+// GetAllOrganizations lists organizations, optionally searching by name. The
+// total number of matching organizations is returned in the X-Total-Count
+// header.
 func GetAllOrganizations(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 
+	query := db.Model(&database.Organization{})
+	if search := c.Query("search"); search != "" {
+		query = query.Where("name ILIKE ?", "%"+utils.EscapeLike(search)+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
 	var orgs []database.Organization
 	limit := min(c.QueryInt("limit", 100), 100)
 	offset := c.QueryInt("offset", 0)
-	result := db.Limit(limit).Offset(offset).Order("name ASC").Find(&orgs)
+	result := query.Limit(limit).Offset(offset).Order("name ASC").Find(&orgs)
 	if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
+	c.Set("X-Total-Count", strconv.FormatInt(total, 10))
 	return c.JSON(orgs)
 }
 
@@ -68,7 +87,10 @@ func GetOrganization(c *fiber.Ctx) error {
 	var org database.Organization
 	result := db.First(&org, "id = ?", organizationID)
 	if result.Error != nil {
-		return c.Status(fiber.StatusBadRequest).SendString("Organization not found")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Organization not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	return c.JSON(org)
@@ -82,7 +104,10 @@ func UpdateOrganization(c *fiber.Ctx) error {
 	var org database.Organization
 	result := db.First(&org, "id = ?", organizationID)
 	if result.Error != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Organization not found"})
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Organization not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	type OrganizationUpdateInput struct {
@@ -130,6 +155,25 @@ func UpdateOrganization(c *fiber.Ctx) error {
 	return c.JSON(org)
 }
 
+// DeleteOrganization soft deletes the organization
+func DeleteOrganization(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+
+	organizationID, err := uuid.Parse(c.Params("org_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid organization ID"})
+	}
+
+	if err := organization.Delete(db, organizationID); err != nil {
+		if errors.Is(err, organization.ErrOrganizationNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Organization not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
 func GetAllOrganizationUsers(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 
@@ -138,7 +182,10 @@ func GetAllOrganizationUsers(c *fiber.Ctx) error {
 	var org database.Organization
 	result := db.First(&org, "id = ?", organizationID)
 	if result.Error != nil {
-		return c.Status(fiber.StatusBadRequest).SendString("Organization not found")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Organization not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	var users []database.User
@@ -146,7 +193,7 @@ func GetAllOrganizationUsers(c *fiber.Ctx) error {
 		Where("application.organization_user.organization_id = ?", org.ID).
 		Find(&users)
 	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Internal server error")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	return c.JSON(users)
@@ -175,19 +222,25 @@ func AddUserToOrganization(c *fiber.Ctx) error {
 	var user database.User
 	result := db.First(&user, "id = ?", input.UserID)
 	if result.Error != nil {
-		return c.Status(fiber.StatusBadRequest).SendString("User not found")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	var org database.Organization
 	result = db.First(&org, "id = ?", organizationID)
 	if result.Error != nil {
-		return c.Status(fiber.StatusBadRequest).SendString("Organization not found")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Organization not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	var count int64
 	result = db.Table("application.organization_user").Where("user_id = ? AND organization_id = ?", user.ID, org.ID).Count(&count)
 	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Internal server error")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 	if count > 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User is already a member of this organization"})
@@ -201,12 +254,96 @@ func AddUserToOrganization(c *fiber.Ctx) error {
 	// TODO: Return the organization user combination
 	result = db.Exec("INSERT INTO application.organization_user (user_id, organization_id, role) VALUES (?, ?, ?)", user.ID, org.ID, input.Role)
 	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Internal server error")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	return c.SendStatus(fiber.StatusCreated) // TODO: Only send status with no content
 }
 
+// InviteUserToOrganization invites someone by email to join the organization
+func InviteUserToOrganization(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	organizationID, err := uuid.Parse(c.Params("org_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid organization ID"})
+	}
+
+	type InviteInput struct {
+		Email string `json:"email" validate:"required,email"`
+		Role  string `json:"role" validate:"omitempty,oneof=reader writer verifier superuser"`
+	}
+
+	var input InviteInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	err = config.Validate.Struct(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	if input.Role == "" {
+		input.Role = "reader"
+	}
+
+	invitation, err := invite.NewService(db, cfg).Invite(input.Email, organizationID, input.Role, &user)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Organization not found"})
+		case errors.Is(err, invite.ErrAlreadyMember):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User is already a member of this organization"})
+		case errors.Is(err, invite.ErrDeletedUser):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Email belongs to a deleted user"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(invitation)
+}
+
+// UpdateOrganizationUserRole changes the role of a member of the organization
+func UpdateOrganizationUserRole(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+
+	type UpdateRoleInput struct {
+		Role string `json:"role" validate:"required,oneof=reader writer verifier superuser"`
+	}
+
+	var input UpdateRoleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	err := config.Validate.Struct(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	organizationID, err := uuid.Parse(c.Params("org_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid organization ID"})
+	}
+	userID, err := uuid.Parse(c.Params("user_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+	}
+
+	result := db.Exec("UPDATE application.organization_user SET role = ? WHERE user_id = ? AND organization_id = ?", input.Role, userID, organizationID)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Membership not found"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
 func RemoveUserFromOrganization(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 
@@ -229,18 +366,24 @@ func RemoveUserFromOrganization(c *fiber.Ctx) error {
 	var user database.User
 	result := db.First(&user, "id = ?", input.UserID)
 	if result.Error != nil {
-		return c.Status(fiber.StatusBadRequest).SendString("User not found")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	var org database.Organization
 	result = db.First(&org, "id = ?", organizationID)
 	if result.Error != nil {
-		return c.Status(fiber.StatusBadRequest).SendString("Organization not found")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Organization not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	result = db.Exec("DELETE FROM application.organization_user WHERE user_id = ? AND organization_id = ?", user.ID, org.ID)
 	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Internal server error")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	return c.SendStatus(fiber.StatusNoContent)
@@ -267,13 +410,16 @@ func AddMapsetToOrganization(c *fiber.Ctx) error {
 	var org database.Organization
 	result := db.First(&org, "id = ?", c.Params("org_id"))
 	if result.Error != nil {
-		return c.Status(fiber.StatusBadRequest).SendString("Organization not found")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Organization not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	result = db.Exec("INSERT INTO maplayer.map_organization (map_id, organization_id) VALUES (?, ?)", input.MapsetID, org.ID)
 	// TODO: This SQL statement can cause a unique constraint violation, handle this error
 	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Internal server error")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	return c.SendStatus(fiber.StatusCreated)
@@ -302,12 +448,15 @@ func RemoveMapsetFromOrganization(c *fiber.Ctx) error {
 	var org database.Organization
 	result := db.First(&org, "id = ?", organizationID)
 	if result.Error != nil {
-		return c.Status(fiber.StatusBadRequest).SendString("Organization not found")
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Organization not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	result = db.Exec("DELETE FROM maplayer.map_organization WHERE map_id = ? AND organization_id = ?", input.MapsetID, org.ID)
 	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).SendString("Internal server error")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	return c.SendStatus(fiber.StatusNoContent)
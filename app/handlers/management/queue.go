@@ -0,0 +1,67 @@
+package mngmt
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/platform/job"
+)
+
+// GetAllQueues lists the settings of every job type with its queue depth,
+// running jobs and failure rate
+func GetAllQueues(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	cfg := c.Locals("config").(*config.Config)
+
+	queues, err := job.NewService(db, cfg).GetQueues()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(queues)
+}
+
+// UpdateQueue changes the settings of the queue of a job type
+func UpdateQueue(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	cfg := c.Locals("config").(*config.Config)
+
+	var input job.QueueInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	if err := config.Validate.Struct(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	queue, err := job.NewService(db, cfg).UpdateQueue(c.Params("job_type"), input)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(queue)
+}
+
+// PauseQueue stops workers from claiming jobs of a type
+func PauseQueue(c *fiber.Ctx) error {
+	return setQueuePaused(c, true)
+}
+
+// ResumeQueue lets workers claim jobs of a paused type again
+func ResumeQueue(c *fiber.Ctx) error {
+	return setQueuePaused(c, false)
+}
+
+func setQueuePaused(c *fiber.Ctx, paused bool) error {
+	db := c.Locals("db").(*gorm.DB)
+	cfg := c.Locals("config").(*config.Config)
+
+	queue, err := job.NewService(db, cfg).SetQueuePaused(c.Params("job_type"), paused)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(queue)
+}
@@ -0,0 +1,65 @@
+package mngmt
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/platform/job"
+)
+
+// GetAllSchedules lists the recurring job schedules
+func GetAllSchedules(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	cfg := c.Locals("config").(*config.Config)
+
+	schedules, err := job.NewService(db, cfg).GetSchedules()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(schedules)
+}
+
+// PauseSchedule stops a schedule from enqueueing jobs
+func PauseSchedule(c *fiber.Ctx) error {
+	return setSchedulePaused(c, true)
+}
+
+// ResumeSchedule lets a paused schedule enqueue jobs again from its next match
+func ResumeSchedule(c *fiber.Ctx) error {
+	return setSchedulePaused(c, false)
+}
+
+func setSchedulePaused(c *fiber.Ctx, paused bool) error {
+	db := c.Locals("db").(*gorm.DB)
+	cfg := c.Locals("config").(*config.Config)
+
+	schedule, err := job.NewService(db, cfg).SetSchedulePaused(c.Params("name"), paused)
+	if err != nil {
+		if errors.Is(err, job.ErrScheduleNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Schedule not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(schedule)
+}
+
+// TriggerSchedule enqueues the job of a schedule right away
+func TriggerSchedule(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	cfg := c.Locals("config").(*config.Config)
+
+	createdJob, err := job.NewService(db, cfg).TriggerSchedule(c.Params("name"))
+	if err != nil {
+		if errors.Is(err, job.ErrScheduleNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Schedule not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(createdJob)
+}
@@ -1,6 +1,9 @@
 package mngmt
 
 import (
+	"errors"
+	"log"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -9,14 +12,18 @@ import (
 
 	"fundermaps/app/config"
 	"fundermaps/app/database"
-	"fundermaps/app/platform/user"
+	"fundermaps/app/platform/apikey"
+	"fundermaps/app/platform/audit"
+	"fundermaps/app/platform/mfa"
+	puser "fundermaps/app/platform/user"
+	"fundermaps/pkg/password"
 	"fundermaps/pkg/utils"
 )
 
 func CreateUser(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 
-	userService := user.NewService(db)
+	userService := puser.NewService(db)
 
 	type UserInput struct {
 		Email    string `json:"email" validate:"required,email"`
@@ -41,9 +48,22 @@ func CreateUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User already exists"})
 	}
 
+	deleted, err := userService.EmailDeleted(email)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+	if deleted {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Email belongs to a deleted user"})
+	}
+
+	hash, err := password.Hash(input.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
 	user = &database.User{
 		Email:        email,
-		PasswordHash: utils.HashLegacyPassword(input.Password),
+		PasswordHash: hash,
 		Role:         "user",
 	}
 
@@ -55,29 +75,54 @@ func CreateUser(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
+// GetAllUsers lists users. They can be searched by email and name, and
+// filtered by role and organization. The total number of matching users is
+// returned in the X-Total-Count header.
 func GetAllUsers(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 
+	query := db.Model(&database.User{})
+	if search := c.Query("search"); search != "" {
+		pattern := "%" + utils.EscapeLike(search) + "%"
+		query = query.Where("email ILIKE ? OR given_name ILIKE ? OR last_name ILIKE ?", pattern, pattern, pattern)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if organizationID := c.Query("organization_id"); organizationID != "" {
+		oid, err := uuid.Parse(organizationID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid organization ID"})
+		}
+		query = query.Where("id IN (?)", db.Table("application.organization_user").Select("user_id").Where("organization_id = ?", oid))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
 	var users []database.User
-	limit := c.QueryInt("limit", 100)
+	limit := min(c.QueryInt("limit", 100), 100)
 	offset := c.QueryInt("offset", 0)
-	result := db.Limit(limit).Offset(offset).Find(&users)
+	result := query.Limit(limit).Offset(offset).Order("email ASC").Find(&users)
 	if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
+	c.Set("X-Total-Count", strconv.FormatInt(total, 10))
 	return c.JSON(users)
 }
 
 func GetUserByEmail(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 
-	userService := user.NewService(db)
+	userService := puser.NewService(db)
 
 	user, err := userService.GetUserByEmail(c.Params("email"))
 	if err != nil {
-		if err.Error() == "user not found" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User not found"})
+		if errors.Is(err, puser.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
@@ -88,7 +133,7 @@ func GetUserByEmail(c *fiber.Ctx) error {
 func GetUser(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 
-	userService := user.NewService(db)
+	userService := puser.NewService(db)
 
 	uid, err := uuid.Parse(c.Params("user_id"))
 	if err != nil {
@@ -96,8 +141,8 @@ func GetUser(c *fiber.Ctx) error {
 	}
 	user, err := userService.GetUserByID(uid)
 	if err != nil {
-		if err.Error() == "user not found" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User not found"})
+		if errors.Is(err, puser.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
@@ -110,7 +155,7 @@ func GetUser(c *fiber.Ctx) error {
 func UpdateUser(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 
-	userService := user.NewService(db)
+	userService := puser.NewService(db)
 
 	type UpdateUserInput struct {
 		GivenName   *string `json:"given_name"`
@@ -136,8 +181,8 @@ func UpdateUser(c *fiber.Ctx) error {
 	}
 	user, err := userService.GetUserByID(uid)
 	if err != nil {
-		if err.Error() == "user not found" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User not found"})
+		if errors.Is(err, puser.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
@@ -166,10 +211,71 @@ func UpdateUser(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
+// DeleteUser soft deletes the user and revokes their sessions, API keys and
+// pending tokens. Administrators cannot delete themselves.
+func DeleteUser(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	admin := c.Locals("user").(database.User)
+
+	uid, err := uuid.Parse(c.Params("user_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+	}
+	if uid == admin.ID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Cannot delete yourself"})
+	}
+
+	if err := puser.NewService(db).Delete(uid); err != nil {
+		if errors.Is(err, puser.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// UserOrganization is an organization the user is a member of
+type UserOrganization struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Role string    `json:"role"`
+}
+
+// GetUserOrganizations lists the organizations of the user with their role
+func GetUserOrganizations(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+
+	uid, err := uuid.Parse(c.Params("user_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+	}
+
+	if _, err := puser.NewService(db).GetUserByID(uid); err != nil {
+		if errors.Is(err, puser.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	organizations := []UserOrganization{}
+	result := db.Table("application.organization").
+		Select("application.organization.id, application.organization.name, application.organization_user.role").
+		Joins("JOIN application.organization_user ON application.organization_user.organization_id = application.organization.id").
+		Where("application.organization_user.user_id = ? AND application.organization.deleted_at IS NULL", uid).
+		Order("application.organization.name").
+		Scan(&organizations)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(organizations)
+}
+
 func ResetUserPassword(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 
-	userService := user.NewService(db)
+	userService := puser.NewService(db)
 
 	type ResetPasswordInput struct {
 		Password string `json:"password" validate:"required,min=6"`
@@ -191,10 +297,10 @@ func ResetUserPassword(c *fiber.Ctx) error {
 	}
 	user, err := userService.GetUserByID(uid)
 	if err != nil {
-		if err.Error() == "user not found" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User not found"})
+		if errors.Is(err, puser.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
 		}
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User not found"})
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
 	err = userService.UpdatePassword(user, input.Password)
@@ -202,6 +308,56 @@ func ResetUserPassword(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
+	admin := c.Locals("user").(database.User)
+	err = audit.NewService(db).Record(audit.Entry{
+		UserID:    user.ID,
+		Action:    audit.ActionPasswordReset,
+		IPAddress: c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Metadata:  map[string]any{"reset_by": admin.ID},
+	})
+	if err != nil {
+		log.Printf("Failed to record password reset: %v", err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ResetUserMFA turns off MFA for a user who lost access to both their
+// authenticator and recovery codes
+func ResetUserMFA(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+
+	uid, err := uuid.Parse(c.Params("user_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+	}
+
+	var user database.User
+	result := db.First(&user, "id = ?", uid)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	if err := mfa.NewService(db).Disable(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	admin := c.Locals("user").(database.User)
+	err = audit.NewService(db).Record(audit.Entry{
+		UserID:    user.ID,
+		Action:    audit.ActionMFAReset,
+		IPAddress: c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Metadata:  map[string]any{"reset_by": admin.ID},
+	})
+	if err != nil {
+		log.Printf("Failed to record MFA reset: %v", err)
+	}
+
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
@@ -211,17 +367,55 @@ func CreateApiKey(c *fiber.Ctx) error {
 	var user database.User
 	result := db.First(&user, "id = ?", c.Params("user_id"))
 	if result.Error != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User not found"})
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
-	apiKey := database.AuthKey{
-		UserID: user.ID,
+	apiKey, err := apikey.NewService(db).Create(user.ID, "Created by administrator", nil)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
-	result = db.Create(&apiKey)
+	return c.JSON(apiKey)
+}
+
+// UnlockUser lifts the lockout of a user before it expires
+func UnlockUser(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+
+	userService := puser.NewService(db)
+
+	uid, err := uuid.Parse(c.Params("user_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+	}
+
+	var user database.User
+	result := db.First(&user, "id = ?", uid)
 	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User not found"})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
-	return c.JSON(apiKey)
+	if err := userService.Unlock(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	admin := c.Locals("user").(database.User)
+	err = audit.NewService(db).Record(audit.Entry{
+		UserID:    user.ID,
+		Action:    audit.ActionUnlock,
+		IPAddress: c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Metadata:  map[string]any{"unlocked_by": admin.ID},
+	})
+	if err != nil {
+		log.Printf("Failed to record unlock: %v", err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
 }
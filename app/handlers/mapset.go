@@ -19,9 +19,15 @@ func GetMapset(c *fiber.Ctx) error {
 	if mapsetID == "" {
 		var mapsets []database.Mapset
 
+		// Only list the mapsets of the active organization, or of every
+		// membership when the user has not chosen one
 		var organizationIDs []uuid.UUID
-		for _, org := range user.Organizations {
-			organizationIDs = append(organizationIDs, org.ID)
+		if organizationID, ok := c.Locals("organization_id").(uuid.UUID); ok {
+			organizationIDs = append(organizationIDs, organizationID)
+		} else {
+			for _, org := range user.Organizations {
+				organizationIDs = append(organizationIDs, org.ID)
+			}
 		}
 
 		// TODO: Move this in part to a database view
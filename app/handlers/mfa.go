@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+	"fundermaps/app/platform/audit"
+	"fundermaps/app/platform/mfa"
+	puser "fundermaps/app/platform/user"
+)
+
+const (
+	MFARedirectURL = "/auth/login/mfa"
+
+	sessionMFAToken     = "mfa_token"
+	sessionLoginRequest = "login_request"
+)
+
+// loginRequest holds the OAuth2 parameters passed along by the login form. It
+// is kept in the session while the user completes the MFA step.
+type loginRequest struct {
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	ResponseType        string `json:"response_type"`
+	State               string `json:"state"`
+	Scope               string `json:"scope"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+func saveLoginRequest(sess *session.Session, mfaToken string, loginReq *loginRequest) error {
+	data, err := json.Marshal(loginReq)
+	if err != nil {
+		return err
+	}
+
+	sess.Set(sessionMFAToken, mfaToken)
+	sess.Set(sessionLoginRequest, string(data))
+	return sess.Save()
+}
+
+func getLoginRequest(sess *session.Session) (string, *loginRequest, bool) {
+	mfaToken, ok := sess.Get(sessionMFAToken).(string)
+	if !ok {
+		return "", nil, false
+	}
+
+	var loginReq loginRequest
+	if data, ok := sess.Get(sessionLoginRequest).(string); ok {
+		if err := json.Unmarshal([]byte(data), &loginReq); err != nil {
+			return "", nil, false
+		}
+	}
+	return mfaToken, &loginReq, true
+}
+
+// LoginWithMFA handles the second step of the login form
+func LoginWithMFA(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+	db := c.Locals("db").(*gorm.DB)
+	store := c.Locals("store").(*session.Store)
+
+	sess, err := store.Get(c)
+	if err != nil {
+		return err
+	}
+
+	mfaToken, loginReq, ok := getLoginRequest(sess)
+	if !ok {
+		return c.Redirect(LoginRedirectURL)
+	}
+
+	user, err := mfa.NewService(db).VerifyChallenge(mfaToken, c.FormValue("code"))
+	if err != nil {
+		if errors.Is(err, mfa.ErrInvalidCode) {
+			registerFailedLogin(c, cfg, db, user, loginFailureInvalidMFACode)
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		if errors.Is(err, mfa.ErrInvalidChallenge) {
+			sess.Delete(sessionMFAToken)
+			sess.Delete(sessionLoginRequest)
+			if err := sess.Save(); err != nil {
+				return err
+			}
+			return c.Redirect(LoginRedirectURL)
+		}
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if puser.NewService(db).IsLocked(user) {
+		recordAuthEvent(c, db, user.ID, audit.ActionLoginFailure, map[string]any{"reason": loginFailureAccountLocked})
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	sess.Delete(sessionMFAToken)
+	sess.Delete(sessionLoginRequest)
+
+	recordLogin(c, db, user.ID, "mfa")
+
+	return completeLogin(c, cfg, db, sess, user.ID, loginReq)
+}
+
+// EnrollMFA generates a new TOTP secret for the current user. MFA stays
+// disabled until the user confirms a code with VerifyMFA.
+func EnrollMFA(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	type EnrollMFAInput struct {
+		CurrentPassword string `json:"current_password" validate:"required"`
+	}
+
+	var input EnrollMFAInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	err := config.Validate.Struct(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	if ok, err := verifyCurrentPassword(c, cfg, db, &user, input.CurrentPassword); !ok {
+		return err
+	}
+
+	secret, uri, err := mfa.NewService(db).Enroll(&user)
+	if err != nil {
+		if errors.Is(err, mfa.ErrAlreadyEnabled) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "MFA is already enabled"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret": secret,
+		"uri":    uri,
+	})
+}
+
+// VerifyMFA enables MFA for the current user and returns the recovery codes.
+// The recovery codes are only shown once.
+func VerifyMFA(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	type MFAInput struct {
+		CurrentPassword string `json:"current_password" validate:"required"`
+		Code            string `json:"code" validate:"required"`
+	}
+
+	var input MFAInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	err := config.Validate.Struct(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	if ok, err := verifyCurrentPassword(c, cfg, db, &user, input.CurrentPassword); !ok {
+		return err
+	}
+
+	recoveryCodes, err := mfa.NewService(db).Enable(&user, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, mfa.ErrAlreadyEnabled):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "MFA is already enabled"})
+		case errors.Is(err, mfa.ErrNotEnrolled):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "MFA enrolment not started"})
+		case errors.Is(err, mfa.ErrInvalidCode):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid MFA code"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(fiber.Map{"recovery_codes": recoveryCodes})
+}
+
+// DisableMFA turns off MFA for the current user, which requires their password
+// and a valid TOTP or recovery code
+func DisableMFA(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	type MFAInput struct {
+		CurrentPassword string `json:"current_password" validate:"required"`
+		Code            string `json:"code" validate:"required"`
+	}
+
+	var input MFAInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	err := config.Validate.Struct(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	if ok, err := verifyCurrentPassword(c, cfg, db, &user, input.CurrentPassword); !ok {
+		return err
+	}
+
+	mfaService := mfa.NewService(db)
+
+	ok, err := mfaService.Verify(&user, input.Code)
+	if err != nil {
+		if errors.Is(err, mfa.ErrNotEnrolled) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "MFA is not enabled"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid MFA code"})
+	}
+
+	if err := mfaService.Disable(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -4,13 +4,19 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
+	"fundermaps/app/config"
 	"fundermaps/app/database"
-	"fundermaps/app/platform/user"
+	"fundermaps/app/platform/audit"
+	"fundermaps/app/platform/oauth"
+	"fundermaps/app/platform/oidc"
+	"fundermaps/app/platform/organization"
+	"fundermaps/app/platform/token"
+	puser "fundermaps/app/platform/user"
+	"fundermaps/pkg/password"
 	"fundermaps/pkg/utils"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -28,6 +34,42 @@ func getClient(db *gorm.DB, clientID string) (database.Application, error) {
 	return client, nil
 }
 
+// authenticateClient identifies the client from the client_id and
+// client_secret form values. Confidential clients must present a valid secret,
+// public clients only need to identify themselves.
+func authenticateClient(c *fiber.Ctx, db *gorm.DB) (database.Application, error) {
+	client, err := getClient(db, c.FormValue("client_id"))
+	if err != nil {
+		return client, err
+	}
+
+	if !client.Public {
+		if !password.Verify(c.FormValue("client_secret"), client.Secret) {
+			return client, errors.New("invalid client secret")
+		}
+	}
+	return client, nil
+}
+
+// TODO: Move to platform
+// resolveRedirectURI checks the redirect URI against the URIs registered for
+// the client. If no redirect URI was given the client must have exactly one
+// registered, which is then used.
+func resolveRedirectURI(client database.Application, redirectURI string) (string, bool) {
+	registered := client.RedirectURLs
+	if len(registered) == 0 && client.RedirectURL != "" {
+		registered = []string{client.RedirectURL}
+	}
+
+	if redirectURI == "" {
+		if len(registered) == 1 {
+			return registered[0], true
+		}
+		return "", false
+	}
+	return redirectURI, oauth.MatchRedirectURI(registered, redirectURI)
+}
+
 // TODO: Move to platform
 func getAuthCode(db *gorm.DB, clientID string, code string) (database.AuthCode, error) {
 	if code == "" {
@@ -43,33 +85,14 @@ func getAuthCode(db *gorm.DB, clientID string, code string) (database.AuthCode,
 }
 
 // TODO: Move to platform
-func generateAuthCode(db *gorm.DB, clientID string, userID uuid.UUID) (string, error) {
-	authToken := database.AuthCode{
-		Code:          utils.GenerateRandomString(32),
-		ApplicationID: clientID,
-		UserID:        userID,
-		ExpiredAt:     time.Now().Add(time.Minute * 5),
-	}
-	if err := db.Create(&authToken).Error; err != nil {
-		return "", err
-	}
-	return authToken.Code, nil
-}
+func generateAuthCode(db *gorm.DB, authCode database.AuthCode) (string, error) {
+	authCode.Code = utils.GenerateRandomString(32)
+	authCode.ExpiredAt = time.Now().Add(time.Minute * 5)
 
-// TODO: Move to platform
-func generateAuthCodeWithPKCE(db *gorm.DB, clientID string, userID uuid.UUID, codeChallenge string, codeChallengeMethod string) (string, error) {
-	authToken := database.AuthCode{
-		Code:                utils.GenerateRandomString(32),
-		ApplicationID:       clientID,
-		UserID:              userID,
-		CodeChallenge:       codeChallenge,
-		CodeChallengeMethod: codeChallengeMethod,
-		ExpiredAt:           time.Now().Add(time.Minute * 5),
-	}
-	if err := db.Create(&authToken).Error; err != nil {
+	if err := db.Create(&authCode).Error; err != nil {
 		return "", err
 	}
-	return authToken.Code, nil
+	return authCode.Code, nil
 }
 
 // TODO: Move to platform
@@ -94,39 +117,60 @@ func verifyPKCE(codeVerifier string, authCode database.AuthCode) bool {
 	}
 }
 
+// invalidTokenOrganization responds to a token request for an organization the
+// user is not a member of
+func invalidTokenOrganization(c *fiber.Ctx, err error) error {
+	if errors.Is(err, organization.ErrNotMember) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request", "error_description": "not a member of the organization"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+}
+
 // TODO: Move to platform
-func getRefreshToken(db *gorm.DB, clientID string, refreshToken string) (database.AuthRefreshToken, error) {
-	if refreshToken == "" {
-		return database.AuthRefreshToken{}, errors.New("refresh_token is required")
+func revokeAuthCode(db *gorm.DB, authCode database.AuthCode) error {
+	return db.Delete(&database.AuthCode{}, "code = ?", authCode.Code).Error
+}
+
+// getRefreshToken looks up a refresh token for the client. Reuse of a rotated
+// token revokes its family in the token service and is recorded in the
+// authentication log here.
+func getRefreshToken(c *fiber.Ctx, db *gorm.DB, clientID string, refreshToken string) (*database.AuthRefreshToken, error) {
+	refresh, err := token.NewService(db).GetRefreshToken(clientID, refreshToken)
+	if errors.Is(err, token.ErrRefreshTokenReused) {
+		recordRefreshTokenReuse(c, db, refresh)
 	}
+	return refresh, err
+}
 
-	var token database.AuthRefreshToken
-	result := db.First(&token, "token = ? AND application_id = ? AND expired_at > now()", refreshToken, clientID)
-	if result.Error != nil {
-		return token, result.Error
+// rotateRefreshToken exchanges the refresh token for a new token pair
+func rotateRefreshToken(c *fiber.Ctx, db *gorm.DB, refreshToken *database.AuthRefreshToken) (*token.AuthToken, error) {
+	authToken, err := token.NewService(db).Rotate(refreshToken, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if errors.Is(err, token.ErrRefreshTokenReused) {
+		recordRefreshTokenReuse(c, db, refreshToken)
 	}
-	return token, nil
+	return authToken, err
 }
 
-// TODO: Move to platform
-func revokeAPIKey(db *gorm.DB, user database.User) error {
-	return db.Where("user_id = ?", user.ID).Delete(&database.ResetKey{}).Error
+func recordRefreshTokenReuse(c *fiber.Ctx, db *gorm.DB, refreshToken *database.AuthRefreshToken) {
+	recordAuthEvent(c, db, refreshToken.UserID, audit.ActionRefreshTokenReuse, map[string]any{
+		"application_id": refreshToken.ApplicationID,
+		"family_id":      refreshToken.FamilyID,
+	})
 }
 
 type UserInfo struct {
-	Sub         string  `json:"sub"`
-	Name        string  `json:"name"`
-	GivenName   *string `json:"given_name,omitempty"`
-	FamilyName  *string `json:"family_name,omitempty"`
-	Email       string  `json:"email"`
-	Picture     *string `json:"picture,omitempty"`
-	PhoneNumber *string `json:"phone_number,omitempty"`
-	Role        string  `json:"role"`
+	Sub           string  `json:"sub"`
+	Name          string  `json:"name"`
+	GivenName     *string `json:"given_name,omitempty"`
+	FamilyName    *string `json:"family_name,omitempty"`
+	Email         string  `json:"email"`
+	EmailVerified bool    `json:"email_verified"`
+	Picture       *string `json:"picture,omitempty"`
+	PhoneNumber   *string `json:"phone_number,omitempty"`
+	Role          string  `json:"role"`
 }
 
-func GetUserInfo(c *fiber.Ctx) error {
-	user := c.Locals("user").(database.User)
-
+func newUserInfo(user *database.User) UserInfo {
 	var name string
 	if user.GivenName != nil {
 		name = *user.GivenName
@@ -138,17 +182,23 @@ func GetUserInfo(c *fiber.Ctx) error {
 		name += *user.LastName
 	}
 
-	userInfo := UserInfo{
-		Sub:         user.ID.String(),
-		Name:        name,
-		GivenName:   user.GivenName,
-		FamilyName:  user.LastName,
-		Email:       user.Email,
-		Picture:     user.Avatar,
-		PhoneNumber: user.PhoneNumber,
-		Role:        user.Role,
+	return UserInfo{
+		Sub:           user.ID.String(),
+		Name:          name,
+		GivenName:     user.GivenName,
+		FamilyName:    user.LastName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Picture:       user.Avatar,
+		PhoneNumber:   user.PhoneNumber,
+		Role:          user.Role,
 	}
-	return c.JSON(userInfo)
+}
+
+func GetUserInfo(c *fiber.Ctx) error {
+	user := c.Locals("user").(database.User)
+
+	return c.JSON(newUserInfo(&user))
 }
 
 // TODO: Move to separate file
@@ -172,11 +222,19 @@ func AuthorizationRequest(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).SendString("Invalid code_challenge_method")
 	}
 
-	_, err := getClient(db, clientID)
+	client, err := getClient(db, clientID)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).SendString("Invalid client ID")
 	}
 
+	if _, ok := resolveRedirectURI(client, c.Query("redirect_uri")); !ok {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid redirect URI")
+	}
+
+	if _, err := oauth.GrantScope(client.Scopes, c.Query("scope")); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("Invalid scope")
+	}
+
 	if responseType != "code" {
 		return c.Status(fiber.StatusUnsupportedMediaType).SendString("Unsupported response type")
 	}
@@ -190,9 +248,10 @@ func AuthorizationRequest(c *fiber.Ctx) error {
 }
 
 func TokenRequest(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
 	db := c.Locals("db").(*gorm.DB)
 
-	userService := user.NewService(db)
+	userService := puser.NewService(db)
 
 	type tokenRequest struct{}
 
@@ -200,18 +259,11 @@ func TokenRequest(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request"})
 	}
 
-	clientID := c.FormValue("client_id")
-	clientSecret := c.FormValue("client_secret")
-	client, err := getClient(db, clientID)
+	client, err := authenticateClient(c, db)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_client"})
 	}
-
-	if !client.Public {
-		if !utils.VerifyPassword(clientSecret, client.Secret) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_client"})
-		}
-	}
+	clientID := client.ApplicationID
 
 	grantType := c.FormValue("grant_type")
 	switch grantType {
@@ -222,6 +274,10 @@ func TokenRequest(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_grant"})
 		}
 
+		if authCode.RedirectURI != "" && authCode.RedirectURI != c.FormValue("redirect_uri") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_grant", "error_description": "redirect_uri does not match"})
+		}
+
 		codeVerifier := c.FormValue("code_verifier")
 		if !verifyPKCE(codeVerifier, authCode) {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_grant", "error_description": "PKCE verification failed"})
@@ -229,7 +285,7 @@ func TokenRequest(c *fiber.Ctx) error {
 
 		user, err := userService.GetUserByID(authCode.UserID)
 		if err != nil {
-			if errors.Is(err, errors.New("user not found")) {
+			if errors.Is(err, puser.ErrUserNotFound) {
 				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_grant"})
 			}
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
@@ -239,21 +295,39 @@ func TokenRequest(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "account_locked"})
 		}
 
-		ctx := AuthContext{db: db, ipAddress: c.IP()}
-		authToken, err := ctx.generateTokensFromAuthCode(authCode)
+		organizationID, err := tokenOrganization(db, user.ID, c.FormValue("organization_id"))
+		if err != nil {
+			return invalidTokenOrganization(c, err)
+		}
+
+		tokenService := token.NewService(db)
+		authToken, err := tokenService.Issue(authCode.ApplicationID, authCode.UserID, organizationID, authCode.Scope, c.IP(), c.Get(fiber.HeaderUserAgent))
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
 		}
-		if err := ctx.revokeAuthCode(authCode); err != nil {
+		if err := revokeAuthCode(db, authCode); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
 		}
 
+		if oidc.HasScope(authCode.Scope, oidc.ScopeOpenID) {
+			authToken.IDToken, err = generateIDToken(c, cfg, db, authCode, user)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+			}
+		}
+
+		recordAuthEvent(c, db, user.ID, audit.ActionOAuthGrant, map[string]any{
+			"application_id": clientID,
+			"grant_type":     grantType,
+			"scope":          authCode.Scope,
+		})
+
 		return c.JSON(authToken)
 
 	case "client_credentials":
 		user, err := userService.GetUserByID(client.UserID)
 		if err != nil {
-			if errors.Is(err, errors.New("user not found")) {
+			if errors.Is(err, puser.ErrUserNotFound) {
 				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_grant"})
 			}
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
@@ -263,24 +337,43 @@ func TokenRequest(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "account_locked"})
 		}
 
-		ctx := AuthContext{db: db, ipAddress: c.IP()}
-		authToken, err := ctx.generateTokensFromUser(clientID, *user) // TODO: pass pointer
+		scope, err := oauth.GrantScope(client.Scopes, c.FormValue("scope"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_scope"})
+		}
+
+		organizationID, err := tokenOrganization(db, user.ID, c.FormValue("organization_id"))
+		if err != nil {
+			return invalidTokenOrganization(c, err)
+		}
+
+		tokenService := token.NewService(db)
+		authToken, err := tokenService.Issue(clientID, user.ID, organizationID, scope, c.IP(), c.Get(fiber.HeaderUserAgent))
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
 		}
 
+		recordAuthEvent(c, db, user.ID, audit.ActionOAuthGrant, map[string]any{
+			"application_id": clientID,
+			"grant_type":     grantType,
+			"scope":          scope,
+		})
+
 		return c.JSON(authToken)
 
 	case "refresh_token":
 		refreshToken := c.FormValue("refresh_token")
-		refresh, err := getRefreshToken(db, clientID, refreshToken)
+		refresh, err := getRefreshToken(c, db, clientID, refreshToken)
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_grant"})
+			if errors.Is(err, token.ErrInvalidRefreshToken) || errors.Is(err, token.ErrRefreshTokenReused) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_grant"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
 		}
 
 		user, err := userService.GetUserByID(refresh.UserID)
 		if err != nil {
-			if errors.Is(err, errors.New("user not found")) {
+			if errors.Is(err, puser.ErrUserNotFound) {
 				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_grant"})
 			}
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
@@ -290,14 +383,15 @@ func TokenRequest(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "account_locked"})
 		}
 
-		ctx := AuthContext{db: db, ipAddress: c.IP()}
-		authToken, err := ctx.generateTokensFromRefreshToken(refresh)
+		authToken, err := rotateRefreshToken(c, db, refresh)
 		if err != nil {
+			if errors.Is(err, token.ErrRefreshTokenReused) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_grant"})
+			}
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
 		}
-		if err := ctx.revokeRefreshToken(refresh); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
-		}
+
+		recordAuthEvent(c, db, user.ID, audit.ActionTokenRefresh, map[string]any{"application_id": clientID})
 
 		return c.JSON(authToken)
 
@@ -305,3 +399,97 @@ func TokenRequest(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unsupported_grant_type"})
 	}
 }
+
+// RevokeToken implements token revocation as described in RFC 7009. Revoking
+// a refresh token also revokes the access tokens issued from its family.
+func RevokeToken(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+
+	client, err := authenticateClient(c, db)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_client"})
+	}
+
+	value := c.FormValue("token")
+	if value == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request"})
+	}
+
+	tokenService := token.NewService(db)
+
+	info, err := tokenService.Find(value, c.FormValue("token_type_hint"))
+	if err != nil {
+		// Unknown tokens are not an error, the client's goal is reached either way
+		if errors.Is(err, token.ErrTokenNotFound) {
+			return c.SendStatus(fiber.StatusOK)
+		}
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "server_error"})
+	}
+
+	if info.ApplicationID != client.ApplicationID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unauthorized_client"})
+	}
+
+	if err := tokenService.Revoke(info); err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "server_error"})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+}
+
+// IntrospectToken implements token introspection as described in RFC 7662.
+// Clients can only introspect their own tokens, any other token is reported
+// as inactive.
+func IntrospectToken(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+
+	client, err := authenticateClient(c, db)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_client"})
+	}
+
+	value := c.FormValue("token")
+	if value == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request"})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	tokenService := token.NewService(db)
+
+	info, err := tokenService.Find(value, c.FormValue("token_type_hint"))
+	if err != nil {
+		if errors.Is(err, token.ErrTokenNotFound) {
+			return c.JSON(IntrospectionResponse{Active: false})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+	}
+
+	if info.ApplicationID != client.ApplicationID || !info.Active() {
+		return c.JSON(IntrospectionResponse{Active: false})
+	}
+
+	response := IntrospectionResponse{
+		Active:   true,
+		Scope:    info.Scope,
+		ClientID: info.ApplicationID,
+		Exp:      info.ExpiredAt.Unix(),
+		Iat:      info.CreatedAt.Unix(),
+		Sub:      info.UserID.String(),
+	}
+	if info.Type == token.HintAccessToken {
+		response.TokenType = token.TokenType
+	}
+
+	return c.JSON(response)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+	"fundermaps/app/platform/oauth"
+	"fundermaps/app/platform/oidc"
+)
+
+// getIssuer returns the configured issuer, or the base URL of the request if
+// none is configured
+func getIssuer(c *fiber.Ctx, cfg *config.Config) string {
+	if cfg.OIDCIssuer != "" {
+		return strings.TrimSuffix(cfg.OIDCIssuer, "/")
+	}
+	return c.BaseURL()
+}
+
+// TODO: Move to platform
+func generateIDToken(c *fiber.Ctx, cfg *config.Config, db *gorm.DB, authCode database.AuthCode, user *database.User) (string, error) {
+	now := time.Now()
+	claims := oidc.Claims{
+		"iss":       getIssuer(c, cfg),
+		"sub":       user.ID.String(),
+		"aud":       authCode.ApplicationID,
+		"exp":       now.Add(oidc.IDTokenExpiration).Unix(),
+		"iat":       now.Unix(),
+		"auth_time": authCode.CreatedAt.Unix(),
+	}
+	if authCode.Nonce != "" {
+		claims["nonce"] = authCode.Nonce
+	}
+
+	userInfo := newUserInfo(user)
+	if oidc.HasScope(authCode.Scope, oidc.ScopeProfile) {
+		claims["name"] = userInfo.Name
+		if userInfo.GivenName != nil {
+			claims["given_name"] = *userInfo.GivenName
+		}
+		if userInfo.FamilyName != nil {
+			claims["family_name"] = *userInfo.FamilyName
+		}
+		if userInfo.Picture != nil {
+			claims["picture"] = *userInfo.Picture
+		}
+	}
+	if oidc.HasScope(authCode.Scope, oidc.ScopeEmail) {
+		claims["email"] = userInfo.Email
+		claims["email_verified"] = userInfo.EmailVerified
+	}
+
+	return oidc.NewService(db, cfg).Sign(claims)
+}
+
+func GetOpenIDConfiguration(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+
+	issuer := getIssuer(c, cfg)
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+	return c.JSON(fiber.Map{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/api/v1/oauth2/authorize",
+		"token_endpoint":                        issuer + "/api/v1/oauth2/token",
+		"userinfo_endpoint":                     issuer + "/api/v1/oauth2/userinfo",
+		"revocation_endpoint":                   issuer + "/api/v1/oauth2/revoke",
+		"introspection_endpoint":                issuer + "/api/v1/oauth2/introspect",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{oidc.AlgorithmRS256, oidc.AlgorithmES256},
+		"scopes_supported":                      oauth.SupportedScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_post"},
+		"grant_types_supported":                 []string{"authorization_code", "client_credentials", "refresh_token"},
+		"code_challenge_methods_supported":      []string{"plain", "S256"},
+		"claims_supported": []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce",
+			"name", "given_name", "family_name", "picture", "email", "email_verified",
+		},
+	})
+}
+
+func GetJWKS(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+	db := c.Locals("db").(*gorm.DB)
+
+	keySet, err := oidc.NewService(db, cfg).KeySet()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(oidc.KeySetMaxAge.Seconds())))
+	return c.JSON(keySet)
+}
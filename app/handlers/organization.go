@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/database"
+	"fundermaps/app/platform/organization"
+)
+
+type OrganizationMember struct {
+	ID         uuid.UUID `json:"id"`
+	Email      string    `json:"email"`
+	GivenName  *string   `json:"given_name"`
+	FamilyName *string   `json:"family_name"`
+	Role       string    `json:"role"`
+}
+
+func GetOrganizationUsers(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	organizationID := c.Locals("organization_id").(uuid.UUID)
+
+	var members []OrganizationMember
+	result := db.Table("application.user").
+		Select("application.user.id, application.user.email, application.user.given_name, application.user.last_name AS family_name, application.organization_user.role").
+		Joins("JOIN application.organization_user ON application.organization_user.user_id = application.user.id").
+		Where("application.organization_user.organization_id = ? AND application.user.deleted_at IS NULL", organizationID).
+		Order("application.user.email").
+		Scan(&members)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.JSON(members)
+}
+
+// RemoveOrganizationUser lets a superuser remove a member from the
+// organization. Superusers cannot remove themselves, so an organization is
+// not left without one by accident.
+func RemoveOrganizationUser(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+	organizationID := c.Locals("organization_id").(uuid.UUID)
+
+	userID, err := uuid.Parse(c.Params("user_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid user ID"})
+	}
+
+	if userID == user.ID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Cannot remove yourself from the organization"})
+	}
+
+	result := db.Exec("DELETE FROM application.organization_user WHERE user_id = ? AND organization_id = ?", userID, organizationID)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "User is not a member of this organization"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// tokenOrganization validates the organization a client asks to bind to a new
+// token as its active organization. An empty value binds none.
+// TODO: Move to platform
+func tokenOrganization(db *gorm.DB, userID uuid.UUID, value string) (*uuid.UUID, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	organizationID, err := uuid.Parse(value)
+	if err != nil {
+		return nil, organization.ErrNotMember
+	}
+
+	roles, err := organization.MembershipRoles(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := roles[organizationID]; !ok {
+		return nil, organization.ErrNotMember
+	}
+
+	return &organizationID, nil
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -32,6 +33,7 @@ type CreateRecoveryInput struct {
 func CreateRecovery(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
 	user := c.Locals("user").(database.User) // TODO: Create a function to get the user from the context
+	organizationID := c.Locals("organization_id").(uuid.UUID)
 
 	var input CreateRecoveryInput
 	if err := c.BodyParser(&input); err != nil {
@@ -66,7 +68,7 @@ func CreateRecovery(c *fiber.Ctx) error {
 		attribution := database.Attribution{
 			Reviewer:   input.AttributionReviewer,
 			Creator:    user.ID,
-			Owner:      user.Organizations[0].ID, // TODO: handle multiple organizations
+			Owner:      organizationID,
 			Contractor: input.AttributionContractor,
 		}
 		if err := tx.Create(&attribution).Error; err != nil {
@@ -100,6 +102,7 @@ func CreateRecovery(c *fiber.Ctx) error {
 
 func CreateRecoverySample(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
+	organizationID := c.Locals("organization_id").(uuid.UUID)
 
 	recoveryIdStr := c.Params("recovery_id")
 	recoveryId, err := strconv.Atoi(recoveryIdStr)
@@ -107,6 +110,16 @@ func CreateRecoverySample(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid recovery_id format", "error": err.Error()})
 	}
 
+	var recovery database.Recovery
+	result := db.Select("id").
+		First(&recovery, "id = ? AND attribution IN (SELECT id FROM application.attribution WHERE owner = ?)", recoveryId, organizationID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Recovery not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to load recovery record", "error": result.Error.Error()})
+	}
+
 	var input database.RecoverySample
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Cannot parse JSON", "error": err.Error()})
@@ -135,3 +148,35 @@ func CreateRecoverySample(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": input.ID})
 }
+
+// UpdateRecoveryStatus changes the audit status of a recovery owned by the organization
+func UpdateRecoveryStatus(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	organizationID := c.Locals("organization_id").(uuid.UUID)
+
+	recoveryID, err := strconv.Atoi(c.Params("recovery_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid recovery_id format", "error": err.Error()})
+	}
+
+	var input UpdateAuditStatusInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Cannot parse JSON", "error": err.Error()})
+	}
+
+	if err := config.Validate.Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	result := db.Model(&database.Recovery{}).
+		Where("id = ? AND attribution IN (SELECT id FROM application.attribution WHERE owner = ?)", recoveryID, organizationID).
+		Updates(map[string]any{"audit_status": input.AuditStatus, "update_date": time.Now()})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to update recovery record", "error": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Recovery not found"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/database"
+	"fundermaps/app/platform/token"
+)
+
+// GetUserSessions lists the devices the current user is signed in on
+func GetUserSessions(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	sessions, err := token.NewService(db).Sessions(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	if sessionID, ok := c.Locals("session_id").(uuid.UUID); ok {
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == sessionID
+		}
+	}
+
+	return c.JSON(sessions)
+}
+
+func RevokeUserSession(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	sessionID, err := uuid.Parse(c.Params("session_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid session ID"})
+	}
+
+	if err := token.NewService(db).RevokeSession(user.ID, sessionID); err != nil {
+		if errors.Is(err, token.ErrSessionNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Session not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RevokeAllUserSessions signs the current user out everywhere, including the
+// session making this request
+func RevokeAllUserSessions(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	if err := token.NewService(db).RevokeAll(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
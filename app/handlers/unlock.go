@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+	"fundermaps/app/platform/audit"
+	"fundermaps/app/platform/job"
+	puser "fundermaps/app/platform/user"
+)
+
+const UnlockTokenExpiration = 24 * time.Hour
+
+// sendUnlockEmail queues an email with a link to lift the lockout of the user
+// without waiting for it to expire. The dedup key holds the lockout count, so
+// the email is queued at most once per lockout.
+func sendUnlockEmail(cfg *config.Config, db *gorm.DB, user *database.User) {
+	unlockToken, err := puser.NewService(db).CreateToken(user.ID, puser.TokenPurposeUnlock, UnlockTokenExpiration)
+	if err != nil {
+		log.Printf("Failed to create unlock token for user %s: %v", user.ID, err)
+		return
+	}
+
+	dedupKey := fmt.Sprintf("unlock-email:%s:%d", user.ID, user.LockoutCount)
+	_, _, err = job.NewService(db, cfg).CreateJob(job.CreateJobInput{
+		JobType: job.JobTypeSendEmail,
+		Payload: map[string]interface{}{
+			"to":       []string{user.Email},
+			"subject":  "FunderMaps - Account geblokkeerd",
+			"template": "unlock-account",
+			"template_vars": map[string]any{
+				"creatorName": user.Email, // TODO: Get the user's name
+				"unlockToken": unlockToken,
+				"lockoutEnd":  user.LockoutEnd.Format(time.RFC3339),
+			},
+		},
+		DedupKey: &dedupKey,
+	})
+	if err != nil {
+		log.Printf("Failed to queue unlock email for user %s: %v", user.ID, err)
+	}
+}
+
+// UnlockAccount lifts a lockout with the token from the unlock email
+func UnlockAccount(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+
+	userService := puser.NewService(db)
+
+	type UnlockInput struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	var input UnlockInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	err := config.Validate.Struct(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	user, err := userService.ConsumeToken(input.Token, puser.TokenPurposeUnlock)
+	if err != nil {
+		if errors.Is(err, puser.ErrInvalidToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+	}
+
+	if err := userService.Unlock(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+	}
+
+	recordAuthEvent(c, db, user.ID, audit.ActionUnlock, nil)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
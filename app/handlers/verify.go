@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+	"fundermaps/app/mail"
+	puser "fundermaps/app/platform/user"
+)
+
+const VerifyEmailTokenExpiration = 48 * time.Hour
+
+// SendEmailVerification mails the current user a link to verify their email
+func SendEmailVerification(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	if user.EmailVerified {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Email is already verified"})
+	}
+
+	userService := puser.NewService(db)
+
+	// Only the latest link works
+	if err := userService.RevokeTokens(user.ID, puser.TokenPurposeVerifyEmail); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	verifyToken, err := userService.CreateToken(user.ID, puser.TokenPurposeVerifyEmail, VerifyEmailTokenExpiration)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	message := mail.Email{
+		Subject:  "FunderMaps - Bevestig je e-mailadres",
+		From:     fmt.Sprintf("Fundermaps <no-reply@%s>", cfg.MailgunDomain),
+		To:       []string{user.Email},
+		Template: "verify-email",
+		TemplateVars: map[string]any{
+			"creatorName": user.Email, // TODO: Get the user's name
+			"verifyToken": verifyToken,
+		},
+	}
+
+	mailer := mail.NewMailer(cfg.MailgunDomain, cfg.MailgunAPIKey, cfg.MailgunAPIBase)
+	if err := mailer.SendTemplatedMail(&message); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to send email"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// VerifyEmail marks the email of the user as verified with the token from
+// the verification email
+func VerifyEmail(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+
+	type VerifyEmailInput struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	var input VerifyEmailInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid input"})
+	}
+
+	err := config.Validate.Struct(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	user, err := puser.NewService(db).ConsumeToken(input.Token, puser.TokenPurposeVerifyEmail)
+	if err != nil {
+		if errors.Is(err, puser.ErrInvalidToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+	}
+
+	if err := db.Model(user).Update("email_verified", true).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
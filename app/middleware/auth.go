@@ -2,16 +2,23 @@ package middleware
 
 import (
 	"errors"
+	"slices"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 
 	"fundermaps/app/database"
+	"fundermaps/app/platform/apikey"
+	"fundermaps/app/platform/oauth"
+	"fundermaps/app/platform/organization"
+	"fundermaps/pkg/utils"
 )
 
 const (
-	HeaderXAPIKey = "X-API-Key"
+	HeaderXAPIKey         = "X-API-Key"
+	HeaderXOrganizationID = "X-Organization-ID"
 )
 
 func AuthMiddleware(c *fiber.Ctx) error {
@@ -19,23 +26,22 @@ func AuthMiddleware(c *fiber.Ctx) error {
 
 	xAPIKey := c.Get(HeaderXAPIKey)
 	if xAPIKey != "" {
-		var user database.User
-		// TODO: Turn into a database view
-		result := db.Joins("JOIN application.auth_key ON application.auth_key.user_id = application.user.id").
-			Where("application.auth_key.key = ?", xAPIKey).
-			Preload("Organizations").
-			First(&user)
-		if result.Error != nil {
-			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		user, err := apikey.NewService(db).Authenticate(xAPIKey, c.IP(), c.Get(fiber.HeaderUserAgent))
+		if err != nil {
+			if errors.Is(err, apikey.ErrInvalidKey) {
 				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Unauthorized"})
 			}
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 		}
 
-		// TODO: Fetch organization role
-		c.Locals("user", user)
+		c.Locals("user", *user)
+		c.Locals("scopes", apiKeyScopes(*user))
 
-		return c.Next()
+		if err := setOrganizationRoles(c, db, user.ID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+		}
+
+		return setActiveOrganization(c, *user, nil)
 	}
 
 	authHeader := c.Get(fiber.HeaderAuthorization)
@@ -49,12 +55,9 @@ func AuthMiddleware(c *fiber.Ctx) error {
 
 	token := strings.TrimPrefix(authHeader, "Bearer ")
 
-	var user database.User
-	// TODO: Turn into a database view
-	result := db.Joins("JOIN application.auth_access_token ON application.auth_access_token.user_id = application.user.id").
-		Where("application.auth_access_token.access_token = ? AND application.auth_access_token.expired_at > now()", token).
-		Preload("Organizations").
-		First(&user)
+	var accessToken database.AuthAccessToken
+	result := db.Preload("User.Organizations").
+		First(&accessToken, "access_token = ? AND expired_at > now()", utils.HashToken(token))
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Unauthorized"})
@@ -62,8 +65,69 @@ func AuthMiddleware(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
 	}
 
-	// TODO: Fetch organization role
-	c.Locals("user", user)
+	c.Locals("user", accessToken.User)
+	c.Locals("scopes", oauth.ParseScope(accessToken.Scope))
+	c.Locals("session_id", accessToken.FamilyID)
+
+	if err := setOrganizationRoles(c, db, accessToken.UserID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	return setActiveOrganization(c, accessToken.User, accessToken.OrganizationID)
+}
+
+// apiKeyScopes returns the scopes granted to an API key of the user. Keys of
+// administrators may also manage the platform.
+func apiKeyScopes(user database.User) []string {
+	if user.Role == "administrator" {
+		return append(slices.Clone(oauth.DefaultScopes), oauth.ScopeManagement)
+	}
+	return oauth.DefaultScopes
+}
+
+// setOrganizationRoles stores the role of the user in each of their
+// organizations for RequireOrganizationRole
+func setOrganizationRoles(c *fiber.Ctx, db *gorm.DB, userID uuid.UUID) error {
+	roles, err := organization.MembershipRoles(db, userID)
+	if err != nil {
+		return err
+	}
+
+	c.Locals("organization_roles", roles)
+	return nil
+}
+
+// setActiveOrganization stores the organization the request acts on. It is
+// chosen with the X-Organization-ID header, else taken from the token, else
+// the only membership of the user. Administrators may act on any
+// organization. Requests without an active organization continue; routes that
+// need one reject them.
+func setActiveOrganization(c *fiber.Ctx, user database.User, bound *uuid.UUID) error {
+	roles := c.Locals("organization_roles").(map[uuid.UUID]string)
+
+	requested := uuid.Nil
+	if header := c.Get(HeaderXOrganizationID); header != "" {
+		id, err := uuid.Parse(header)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid organization ID"})
+		}
+		requested = id
+	}
+
+	if requested != uuid.Nil && user.Role == "administrator" {
+		c.Locals("organization_id", requested)
+		return c.Next()
+	}
+
+	organizationID, err := organization.ActiveOrganization(roles, requested, bound)
+	switch {
+	case err == nil:
+		c.Locals("organization_id", organizationID)
+	case errors.Is(err, organization.ErrNotMember):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Not a member of this organization"})
+	case !errors.Is(err, organization.ErrNoActiveOrganization):
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
 
 	return c.Next()
 }
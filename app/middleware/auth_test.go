@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"fundermaps/app/database"
+	"fundermaps/app/platform/oauth"
+)
+
+func TestAPIKeyManagementAccess(t *testing.T) {
+	testCases := []struct {
+		role     string
+		expected int
+	}{
+		{"administrator", fiber.StatusOK},
+		{"user", fiber.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		user := database.User{Role: tc.role}
+
+		app := fiber.New()
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals("user", user)
+			c.Locals("scopes", apiKeyScopes(user))
+			return c.Next()
+		})
+		app.Get("/management", RequireScope(oauth.ScopeManagement), AdminMiddleware, func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		})
+
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/management", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.expected {
+			t.Errorf("API key of %s on management route = %d; want %d", tc.role, resp.StatusCode, tc.expected)
+		}
+	}
+}
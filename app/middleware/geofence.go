@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/database"
+	"fundermaps/app/platform/geocoder"
+	"fundermaps/app/platform/organization"
+)
+
+// GeofenceMiddleware rejects requests for buildings outside the fence of the
+// active organization. Administrators and organizations without a fence are
+// not restricted; other users need an active organization. Must run after
+// AuthMiddleware on routes with a building_id parameter.
+func GeofenceMiddleware(c *fiber.Ctx) error {
+	db := c.Locals("db").(*gorm.DB)
+	user := c.Locals("user").(database.User)
+
+	if user.Role == "administrator" {
+		return c.Next()
+	}
+
+	organizationID, ok := c.Locals("organization_id").(uuid.UUID)
+	if !ok {
+		roles, _ := c.Locals("organization_roles").(map[uuid.UUID]string)
+		return noActiveOrganization(c, roles)
+	}
+
+	var org database.Organization
+	if err := db.First(&org, "id = ?", organizationID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	fence := organization.FenceOf(&org)
+	if fence.Unrestricted() {
+		return c.Next()
+	}
+
+	building, err := geocoder.NewService(db).GetBuildingByGeocoderID(c.Params("building_id"))
+	if err != nil {
+		if err.Error() == "building not found" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Building not found"})
+		} else if err.Error() == "unknown geocoder identifier" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Unknown geocoder identifier"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Internal server error"})
+	}
+
+	if !fence.Contains(building.MunicipalityID, building.DistrictID, building.NeighborhoodID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Building is outside the fence of this organization",
+			"code":    "outside_geofence",
+		})
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"fundermaps/app/database"
+	"fundermaps/app/platform/organization"
+)
+
+// RequireOrganizationRole rejects requests from users without at least the
+// role in the organization the request acts on. That is the organization in
+// the org_id route parameter, or else the active organization. Administrators
+// are allowed everywhere. On success the organization ID is stored in the
+// context. Must run after AuthMiddleware.
+func RequireOrganizationRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user := c.Locals("user").(database.User)
+		roles, _ := c.Locals("organization_roles").(map[uuid.UUID]string)
+
+		var organizationID uuid.UUID
+		if param := c.Params("org_id"); param != "" {
+			id, err := uuid.Parse(param)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid organization ID"})
+			}
+			organizationID = id
+		} else if active, ok := c.Locals("organization_id").(uuid.UUID); ok {
+			organizationID = active
+		}
+
+		if organizationID == uuid.Nil {
+			return noActiveOrganization(c, roles)
+		}
+
+		if user.Role == "administrator" {
+			c.Locals("organization_id", organizationID)
+			return c.Next()
+		}
+
+		memberRole, ok := roles[organizationID]
+		if !ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Not a member of this organization",
+			})
+		}
+		if !organization.HasRole(memberRole, role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message":       fmt.Sprintf("Requires the %s role in this organization", role),
+				"role":          memberRole,
+				"required_role": role,
+			})
+		}
+
+		c.Locals("organization_id", organizationID)
+		return c.Next()
+	}
+}
+
+// noActiveOrganization rejects a request that needs an organization while none
+// could be chosen for the user
+func noActiveOrganization(c *fiber.Ctx, roles map[uuid.UUID]string) error {
+	if len(roles) == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Not a member of any organization",
+		})
+	}
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"message": fmt.Sprintf("Member of several organizations, choose one with the %s header", HeaderXOrganizationID),
+	})
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"fundermaps/app/platform/oauth"
+)
+
+// RequireScope rejects requests whose access token was not granted the scope.
+// Must run after AuthMiddleware.
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scopes, _ := c.Locals("scopes").([]string)
+		if !oauth.HasScope(scopes, scope) {
+			c.Set(fiber.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Insufficient scope",
+			})
+		}
+
+		return c.Next()
+	}
+}
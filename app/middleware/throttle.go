@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/platform/audit"
+)
+
+// ThrottleFailedLogins rejects sign in attempts from an IP address with too
+// many failed attempts in the throttle window, regardless of the account. This
+// slows down credential stuffing that stays below the per account lockout.
+func ThrottleFailedLogins(c *fiber.Ctx) error {
+	cfg := c.Locals("config").(*config.Config)
+	db := c.Locals("db").(*gorm.DB)
+
+	window := time.Duration(cfg.LoginThrottleWindow) * time.Minute
+
+	failures, err := audit.NewService(db).CountRecent(audit.ActionLoginFailure, c.IP(), time.Now().Add(-window))
+	if err != nil {
+		log.Printf("Failed to count failed logins: %v", err)
+		return c.Next()
+	}
+
+	if failures >= int64(cfg.LoginThrottleLimit) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(window.Seconds())))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"message": "Too many failed login attempts"})
+	}
+
+	return c.Next()
+}
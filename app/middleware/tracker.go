@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 
 	"fundermaps/app/database"
@@ -11,14 +12,13 @@ import (
 
 func TrackerMiddleware(c *fiber.Ctx) error {
 	db := c.Locals("db").(*gorm.DB)
-	user := c.Locals("user").(database.User)
-
-	if len(user.Organizations) == 0 {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Forbidden"})
+	// Products are billed to the active organization
+	organizationID, ok := c.Locals("organization_id").(uuid.UUID)
+	if !ok {
+		roles, _ := c.Locals("organization_roles").(map[uuid.UUID]string)
+		return noActiveOrganization(c, roles)
 	}
 
-	firstOrganization := user.Organizations[0]
-
 	n := c.Next()
 
 	tracker := c.Locals("tracker").(database.ProductTracker)
@@ -46,7 +46,7 @@ func TrackerMiddleware(c *fiber.Ctx) error {
 			RETURNING 1
 		)
 		SELECT EXISTS (SELECT 1 FROM register_product_request) AS is_registered
-	`, firstOrganization.ID, tracker.Name, tracker.BuildingID, tracker.Identifier, firstOrganization.ID, tracker.Name, tracker.Identifier).Scan(&isRegistered)
+	`, organizationID, tracker.Name, tracker.BuildingID, tracker.Identifier, organizationID, tracker.Name, tracker.Identifier).Scan(&isRegistered)
 
 	c.Set("X-Product-Registered", fmt.Sprintf("%t", isRegistered))
 
@@ -0,0 +1,142 @@
+package apikey
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/database"
+	"fundermaps/app/platform/audit"
+	"fundermaps/pkg/utils"
+)
+
+const (
+	Prefix = "fmsk."
+
+	// LastUsedInterval limits how often the last use of a key is written
+	LastUsedInterval = time.Minute
+)
+
+var (
+	ErrInvalidKey  = errors.New("invalid api key")
+	ErrKeyNotFound = errors.New("api key not found")
+)
+
+// CreatedKey is returned once when a key is created. It is the only time the
+// plaintext key is available.
+type CreatedKey struct {
+	database.AuthKey
+	Key string `json:"key"`
+}
+
+// Service manages the API keys users authenticate with through the X-API-Key
+// header. Keys are stored as SHA-256 hashes.
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new API key service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Create generates a new key for the user
+func (s *Service) Create(userID uuid.UUID, name string, expiredAt *time.Time) (*CreatedKey, error) {
+	key := Prefix + utils.GenerateRandomString(32)
+
+	authKey := database.AuthKey{
+		Key:       utils.HashToken(key),
+		Name:      name,
+		Hint:      hint(key),
+		UserID:    userID,
+		ExpiredAt: expiredAt,
+	}
+	if err := s.db.Create(&authKey).Error; err != nil {
+		return nil, err
+	}
+
+	return &CreatedKey{AuthKey: authKey, Key: key}, nil
+}
+
+// List returns the keys of the user, newest first
+func (s *Service) List(userID uuid.UUID) ([]database.AuthKey, error) {
+	var authKeys []database.AuthKey
+	result := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&authKeys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return authKeys, nil
+}
+
+// Revoke deletes a key of the user
+func (s *Service) Revoke(userID uuid.UUID, id uuid.UUID) error {
+	result := s.db.Delete(&database.AuthKey{}, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the user the key belongs to and records its use.
+// Keys created before they were stored hashed are hashed on first use.
+func (s *Service) Authenticate(key string, ipAddress string, userAgent string) (*database.User, error) {
+	var authKey database.AuthKey
+	result := s.db.Preload("User.Organizations").
+		First(&authKey, "key = ? AND (expired_at IS NULL OR expired_at > now())", utils.HashToken(key))
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) && strings.HasPrefix(key, Prefix) {
+		result = s.db.Preload("User.Organizations").First(&authKey, "key = ?", key)
+		if result.Error == nil {
+			if err := s.upgradeLegacyKey(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidKey
+		}
+		return nil, result.Error
+	}
+
+	// Only one of several concurrent requests gets to write the last use, and
+	// only that request is recorded in the authentication log
+	result = s.db.Model(&database.AuthKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", authKey.ID, time.Now().Add(-LastUsedInterval)).
+		Updates(map[string]any{"last_used_at": time.Now(), "last_used_ip": ipAddress})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		err := audit.NewService(s.db).Record(audit.Entry{
+			UserID:    authKey.UserID,
+			Action:    audit.ActionAPIKeyUse,
+			IPAddress: ipAddress,
+			UserAgent: userAgent,
+			Metadata:  map[string]any{"key_id": authKey.ID, "hint": authKey.Hint},
+		})
+		if err != nil {
+			log.Printf("Failed to record api key use: %v", err)
+		}
+	}
+
+	return &authKey.User, nil
+}
+
+func (s *Service) upgradeLegacyKey(key string) error {
+	return s.db.Model(&database.AuthKey{}).
+		Where("key = ?", key).
+		Updates(map[string]any{"key": utils.HashToken(key), "hint": hint(key)}).Error
+}
+
+// hint returns the last characters of the key so users can tell keys apart
+func hint(key string) string {
+	return key[len(key)-4:]
+}
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/database"
+)
+
+// Actions recorded in the authentication log
+const (
+	ActionLoginSuccess         = "login_success"
+	ActionLoginFailure         = "login_failure"
+	ActionLockout              = "lockout"
+	ActionUnlock               = "unlock"
+	ActionMFAReset             = "mfa_reset"
+	ActionPasswordChange       = "password_change"
+	ActionPasswordResetRequest = "password_reset_request"
+	ActionPasswordReset        = "password_reset"
+	ActionTokenRefresh         = "token_refresh"
+	ActionRefreshTokenReuse    = "refresh_token_reuse"
+	ActionAPIKeyUse            = "api_key_use"
+	ActionOAuthGrant           = "oauth_grant"
+)
+
+// Entry describes a single authentication event. UserID is uuid.Nil when the
+// event cannot be tied to a user, such as a login with an unknown email.
+type Entry struct {
+	UserID    uuid.UUID
+	Action    string
+	IPAddress string
+	UserAgent string
+	Metadata  map[string]any
+}
+
+// Service writes authentication events to application.auth_logs
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new audit service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Record stores an authentication event
+func (s *Service) Record(entry Entry) error {
+	authLog := database.AuthLog{
+		ActionType: entry.Action,
+		IPAddress:  entry.IPAddress,
+		UserAgent:  entry.UserAgent,
+		Metadata:   database.JSONObject(entry.Metadata),
+	}
+	if entry.UserID != uuid.Nil {
+		authLog.UserID = &entry.UserID
+	}
+
+	return s.db.Create(&authLog).Error
+}
+
+// QueryOptions defines options for filtering the authentication log
+type QueryOptions struct {
+	UserID    uuid.UUID
+	Action    string
+	IPAddress string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
+
+// Query returns the matching events, most recent first, and the total number
+// of matching events
+func (s *Service) Query(options QueryOptions) ([]database.AuthLog, int64, error) {
+	query := s.db.Model(&database.AuthLog{})
+
+	if options.UserID != uuid.Nil {
+		query = query.Where("user_id = ?", options.UserID)
+	}
+	if options.Action != "" {
+		query = query.Where("action_type = ?", options.Action)
+	}
+	if options.IPAddress != "" {
+		query = query.Where("ip_address = ?", options.IPAddress)
+	}
+	if !options.From.IsZero() {
+		query = query.Where("timestamp >= ?", options.From)
+	}
+	if !options.To.IsZero() {
+		query = query.Where("timestamp < ?", options.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Apply pagination with defaults
+	limit := options.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	offset := options.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	var logs []database.AuthLog
+	result := query.Order("timestamp DESC, log_id DESC").Limit(limit).Offset(offset).Find(&logs)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+
+	return logs, total, nil
+}
+
+// CountRecent returns the number of events of the given action from the IP
+// address since the given time
+func (s *Service) CountRecent(action string, ipAddress string, since time.Time) (int64, error) {
+	var count int64
+	err := s.db.Model(&database.AuthLog{}).
+		Where("action_type = ? AND ip_address = ? AND timestamp >= ?", action, ipAddress, since).
+		Count(&count).Error
+	return count, err
+}
+
+// Prune deletes all events recorded before the given time and returns the
+// number of deleted events
+func (s *Service) Prune(before time.Time) (int64, error) {
+	result := s.db.Where("timestamp < ?", before).Delete(&database.AuthLog{})
+	return result.RowsAffected, result.Error
+}
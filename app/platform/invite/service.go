@@ -0,0 +1,234 @@
+package invite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+	"fundermaps/app/mail"
+	"fundermaps/app/platform/oidc"
+	puser "fundermaps/app/platform/user"
+	"fundermaps/pkg/password"
+)
+
+const (
+	InvitationExpiration = 7 * 24 * time.Hour
+
+	// tokenType keeps other tokens signed with the same key, such as ID tokens,
+	// from being accepted as an invitation
+	tokenType = "invitation"
+)
+
+var (
+	ErrAlreadyMember     = errors.New("user is already a member of the organization")
+	ErrInvalidInvitation = errors.New("invalid or expired invitation")
+	ErrPasswordRequired  = errors.New("password is required for new users")
+	ErrDeletedUser       = errors.New("email belongs to a deleted user")
+)
+
+// Service invites users into organizations. The link in the invitation email
+// carries a token signed with the OpenID provider key. The invitation itself
+// is stored so it can only be accepted once.
+type Service struct {
+	db   *gorm.DB
+	cfg  *config.Config
+	oidc *oidc.Service
+}
+
+// NewService creates a new invitation service
+func NewService(db *gorm.DB, cfg *config.Config) *Service {
+	return &Service{
+		db:   db,
+		cfg:  cfg,
+		oidc: oidc.NewService(db, cfg),
+	}
+}
+
+// Invite creates an invitation and mails the invitation link to the email
+func (s *Service) Invite(email string, organizationID uuid.UUID, role string, invitedBy *database.User) (*database.Invitation, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	var organization database.Organization
+	if err := s.db.First(&organization, "id = ?", organizationID).Error; err != nil {
+		return nil, err
+	}
+
+	var count int64
+	err := s.db.Table("application.organization_user").
+		Joins("JOIN application.user u ON u.id = organization_user.user_id").
+		Where("u.email = ? AND organization_user.organization_id = ?", email, organizationID).
+		Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrAlreadyMember
+	}
+
+	deleted, err := puser.NewService(s.db).EmailDeleted(email)
+	if err != nil {
+		return nil, err
+	}
+	if deleted {
+		return nil, ErrDeletedUser
+	}
+
+	invitation := database.Invitation{
+		Email:          email,
+		OrganizationID: organizationID,
+		Role:           role,
+		InvitedByID:    invitedBy.ID,
+		ExpiredAt:      time.Now().Add(InvitationExpiration),
+	}
+	if err := s.db.Create(&invitation).Error; err != nil {
+		return nil, err
+	}
+	invitation.Organization = organization
+
+	token, err := s.oidc.Sign(oidc.Claims{
+		"typ":   tokenType,
+		"jti":   invitation.ID.String(),
+		"email": invitation.Email,
+		"iat":   invitation.CreatedAt.Unix(),
+		"exp":   invitation.ExpiredAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	message := mail.Email{
+		Subject:  fmt.Sprintf("FunderMaps - Uitnodiging voor %s", organization.Name),
+		From:     fmt.Sprintf("Fundermaps <no-reply@%s>", s.cfg.MailgunDomain),
+		To:       []string{invitation.Email},
+		Template: "invitation",
+		TemplateVars: map[string]any{
+			"creatorName":      invitedBy.Email, // TODO: Get the user's name
+			"organizationName": organization.Name,
+			"invitationToken":  token,
+		},
+	}
+
+	mailer := mail.NewMailer(s.cfg.MailgunDomain, s.cfg.MailgunAPIKey, s.cfg.MailgunAPIBase)
+	if err := mailer.SendTemplatedMail(&message); err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+// Get returns the pending invitation for the token
+func (s *Service) Get(token string) (*database.Invitation, error) {
+	claims, err := s.oidc.Verify(token)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidToken) || errors.Is(err, oidc.ErrUnknownKey) || errors.Is(err, oidc.ErrTokenExpired) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+	if typ, _ := claims["typ"].(string); typ != tokenType {
+		return nil, ErrInvalidInvitation
+	}
+
+	invitationID, err := uuid.Parse(fmt.Sprint(claims["jti"]))
+	if err != nil {
+		return nil, ErrInvalidInvitation
+	}
+
+	var invitation database.Invitation
+	result := s.db.Preload("Organization").
+		First(&invitation, "id = ? AND accepted_at IS NULL AND expired_at > now()", invitationID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, result.Error
+	}
+
+	return &invitation, nil
+}
+
+// AcceptInput holds the details of the invitee. The password and names are
+// only used when no account exists for the email yet.
+type AcceptInput struct {
+	Password   string
+	GivenName  *string
+	FamilyName *string
+}
+
+// Accept adds the invitee to the organization, creating their account if
+// needed. Accepting proves the invitee owns the email, so it is marked as
+// verified.
+func (s *Service) Accept(token string, input AcceptInput) (*database.User, error) {
+	invitation, err := s.Get(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var user database.User
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL", invitation.ID).
+			Update("accepted_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidInvitation
+		}
+
+		deleted, err := puser.NewService(tx).EmailDeleted(invitation.Email)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			return ErrDeletedUser
+		}
+
+		result = tx.First(&user, "email = ?", invitation.Email)
+		switch {
+		case result.Error == nil:
+			if err := tx.Model(&user).Update("email_verified", true).Error; err != nil {
+				return err
+			}
+		case errors.Is(result.Error, gorm.ErrRecordNotFound):
+			if input.Password == "" {
+				return ErrPasswordRequired
+			}
+
+			hash, err := password.Hash(input.Password)
+			if err != nil {
+				return err
+			}
+
+			user = database.User{
+				Email:         invitation.Email,
+				EmailVerified: true,
+				GivenName:     input.GivenName,
+				LastName:      input.FamilyName,
+				PasswordHash:  hash,
+				Role:          "user",
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		default:
+			return result.Error
+		}
+
+		return tx.Exec(`
+			INSERT INTO application.organization_user (user_id, organization_id, role)
+			VALUES (?, ?, ?)
+			ON CONFLICT DO NOTHING`, user.ID, invitation.OrganizationID, invitation.Role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,47 @@
+package job
+
+import (
+	"time"
+
+	"fundermaps/app/database"
+)
+
+// StartAttempt records the start of a run of the job by the worker
+func (s *Service) StartAttempt(job *database.WorkerJob, workerID string) (*database.WorkerJobAttempt, error) {
+	attempt := database.WorkerJobAttempt{
+		JobID:     job.ID,
+		Attempt:   job.RetryCount + 1,
+		WorkerID:  workerID,
+		Status:    database.JobStatusRunning,
+		StartedAt: time.Now(),
+	}
+	if err := s.db.Create(&attempt).Error; err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// FinishAttempt records the outcome of a run. A nil error means the run
+// completed.
+func (s *Service) FinishAttempt(attempt *database.WorkerJobAttempt, runErr error) error {
+	updates := map[string]interface{}{
+		"status":      database.JobStatusComplete,
+		"finished_at": time.Now(),
+	}
+	if runErr != nil {
+		updates["status"] = database.JobStatusFailed
+		updates["error"] = runErr.Error()
+	}
+
+	return s.db.Model(attempt).Updates(updates).Error
+}
+
+// GetAttempts returns the attempt history of the job, oldest first
+func (s *Service) GetAttempts(jobID string) ([]database.WorkerJobAttempt, error) {
+	attempts := []database.WorkerJobAttempt{}
+	result := s.db.Where("job_id = ?", jobID).Order("started_at ASC, id ASC").Find(&attempts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return attempts, nil
+}
@@ -0,0 +1,68 @@
+package job
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"fundermaps/app/database"
+)
+
+// dedupConflict skips the insert when an active job holds the dedup key. The
+// predicate must match the partial index idx_worker_jobs_dedup_key.
+var dedupConflict = clause.OnConflict{
+	Columns: []clause.Column{{Name: "dedup_key"}},
+	TargetWhere: clause.Where{Exprs: []clause.Expression{
+		clause.Expr{SQL: "dedup_key IS NOT NULL AND status IN ('pending','retry','running')"},
+	}},
+	DoNothing: true,
+}
+
+// isUniqueViolation reports whether the database rejected a statement because
+// it violates a unique index, such as idx_worker_jobs_dedup_key
+func isUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	return errors.As(err, &pgErr) && pgErr.SQLState() == "23505"
+}
+
+// DedupWindow returns how long a completed job keeps its dedup key
+func (s *Service) DedupWindow() time.Duration {
+	if s.cfg == nil {
+		return 0
+	}
+	return time.Duration(s.cfg.WorkerDedupWindow) * time.Minute
+}
+
+// DedupCutoff returns the completion time after which a completed job still
+// counts as a duplicate, or the zero time if completed jobs never do
+func DedupCutoff(now time.Time, window time.Duration) time.Time {
+	if window <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-window)
+}
+
+// findDuplicateJob returns the active job with the dedup key, or the most
+// recent job completed within the dedup window, or nil if there is none.
+func (s *Service) findDuplicateJob(dedupKey string) (*database.WorkerJob, error) {
+	query := s.db.Where("dedup_key = ?", dedupKey)
+	if cutoff := DedupCutoff(time.Now(), s.DedupWindow()); !cutoff.IsZero() {
+		query = query.Where("status IN ? OR (status = ? AND updated_at > ?)", ActiveStatuses, database.JobStatusComplete, cutoff)
+	} else {
+		query = query.Where("status IN ?", ActiveStatuses)
+	}
+
+	// An active job takes precedence over a completed one
+	var job database.WorkerJob
+	result := query.Order("status = 'complete' ASC, id DESC").First(&job)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+
+	return &job, nil
+}
@@ -0,0 +1,139 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+)
+
+func TestDedupCutoff(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	if cutoff := DedupCutoff(now, 0); !cutoff.IsZero() {
+		t.Errorf("DedupCutoff(now, 0) = %s; want zero time", cutoff)
+	}
+	if want := now.Add(-10 * time.Minute); !DedupCutoff(now, 10*time.Minute).Equal(want) {
+		t.Errorf("DedupCutoff(now, 10m) = %s; want %s", DedupCutoff(now, 10*time.Minute), want)
+	}
+}
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestIsUniqueViolation(t *testing.T) {
+	if !isUniqueViolation(fmt.Errorf("update: %w", sqlStateError("23505"))) {
+		t.Error("isUniqueViolation(23505) = false; want true")
+	}
+	if isUniqueViolation(sqlStateError("23503")) {
+		t.Error("isUniqueViolation(23503) = true; want false")
+	}
+	if isUniqueViolation(errors.New("connection refused")) {
+		t.Error("isUniqueViolation(connection refused) = true; want false")
+	}
+}
+
+// testService connects to the database in FM_TEST_DATABASE_URL, which must
+// hold the application schema with app/database/migrations applied. The test
+// is skipped without it.
+func testService(t *testing.T, dedupWindow int) *Service {
+	url := os.Getenv("FM_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("FM_TEST_DATABASE_URL not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(url), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&database.WorkerJob{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewService(db, &config.Config{WorkerDedupWindow: dedupWindow})
+}
+
+func testDedupKey(t *testing.T, s *Service) string {
+	key := fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+	t.Cleanup(func() {
+		s.db.Where("dedup_key = ?", key).Delete(&database.WorkerJob{})
+	})
+	return key
+}
+
+func TestCreateJobDedupConcurrent(t *testing.T) {
+	s := testService(t, 0)
+	key := testDedupKey(t, s)
+
+	const n = 20
+	var wg sync.WaitGroup
+	ids := make([]int64, n)
+	created := make([]bool, n)
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job, ok, err := s.CreateJob(CreateJobInput{JobType: "test", DedupKey: &key})
+			if err == nil {
+				ids[i], created[i] = job.ID, ok
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	count := 0
+	for i := range n {
+		if errs[i] != nil {
+			t.Fatalf("CreateJob failed: %v", errs[i])
+		}
+		if ids[i] != ids[0] {
+			t.Errorf("CreateJob returned job %d; want %d", ids[i], ids[0])
+		}
+		if created[i] {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("created %d jobs; want 1", count)
+	}
+}
+
+func TestCreateJobDedupWindow(t *testing.T) {
+	s := testService(t, 10)
+	key := testDedupKey(t, s)
+
+	first, created, err := s.CreateJob(CreateJobInput{JobType: "test", DedupKey: &key})
+	if err != nil || !created {
+		t.Fatalf("CreateJob = %v, %v; want created", created, err)
+	}
+	if err := s.MarkJobAsComplete(strconv.FormatInt(first.ID, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the window the completed job is returned
+	second, created, err := s.CreateJob(CreateJobInput{JobType: "test", DedupKey: &key})
+	if err != nil || created || second.ID != first.ID {
+		t.Fatalf("CreateJob within window = %v, %v; want job %d", created, err, first.ID)
+	}
+
+	// Past the window a new job is queued
+	s.db.Model(&database.WorkerJob{}).Where("id = ?", first.ID).Update("updated_at", time.Now().Add(-time.Hour))
+	third, created, err := s.CreateJob(CreateJobInput{JobType: "test", DedupKey: &key})
+	if err != nil || !created || third.ID == first.ID {
+		t.Fatalf("CreateJob after window = %v, %v; want new job", created, err)
+	}
+}
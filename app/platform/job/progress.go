@@ -0,0 +1,69 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"fundermaps/app/database"
+)
+
+var ErrNoRunningJob = errors.New("context does not belong to a running job")
+
+type reporterKey struct{}
+
+// reporter lets a handler write progress and results to the job it runs
+type reporter struct {
+	service *Service
+	jobID   int64
+}
+
+// withReporter returns a context through which the handler of the job can
+// report progress
+func withReporter(ctx context.Context, service *Service, jobID int64) context.Context {
+	return context.WithValue(ctx, reporterKey{}, &reporter{service: service, jobID: jobID})
+}
+
+// ReportProgress stores the progress of the running job as a percentage
+// between 0 and 100 with an optional message. It also tells the queue the job
+// is still alive. Handlers call it with the context they were given.
+func ReportProgress(ctx context.Context, percent int, message string) error {
+	r, ok := ctx.Value(reporterKey{}).(*reporter)
+	if !ok {
+		return ErrNoRunningJob
+	}
+
+	var progressMessage *string
+	if message != "" {
+		progressMessage = &message
+	}
+
+	return r.service.db.WithContext(ctx).Model(&database.WorkerJob{}).
+		Where("id = ? AND status = ?", r.jobID, database.JobStatusRunning).
+		Updates(map[string]interface{}{
+			"progress":         ClampProgress(percent),
+			"progress_message": progressMessage,
+			"updated_at":       time.Now(),
+		}).Error
+}
+
+// SetResult stores the output of the running job. It replaces any result
+// stored before.
+func SetResult(ctx context.Context, result map[string]interface{}) error {
+	r, ok := ctx.Value(reporterKey{}).(*reporter)
+	if !ok {
+		return ErrNoRunningJob
+	}
+
+	return r.service.db.WithContext(ctx).Model(&database.WorkerJob{}).
+		Where("id = ? AND status = ?", r.jobID, database.JobStatusRunning).
+		Updates(map[string]interface{}{
+			"result":     database.JSONObject(result),
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// ClampProgress limits a percentage to the range 0 to 100
+func ClampProgress(percent int) int {
+	return min(max(percent, 0), 100)
+}
@@ -0,0 +1,287 @@
+package job
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"fundermaps/app/database"
+)
+
+const (
+	rateWindow        = time.Minute
+	failureRateWindow = 24 * time.Hour
+)
+
+// QueueInput changes the settings of a queue. Fields left nil are unchanged.
+type QueueInput struct {
+	MaxConcurrency    *int  `json:"max_concurrency" validate:"omitempty,min=0"`
+	RateLimit         *int  `json:"rate_limit" validate:"omitempty,min=0"`
+	DefaultPriority   *int  `json:"default_priority"`
+	DefaultMaxRetries *int  `json:"default_max_retries" validate:"omitempty,min=0"`
+	Paused            *bool `json:"paused"`
+}
+
+// QueueStatus is a queue with the current state of its jobs
+type QueueStatus struct {
+	database.WorkerQueue
+	Depth       int64   `json:"depth"` // Pending and retrying jobs
+	Running     int64   `json:"running"`
+	FailureRate float64 `json:"failure_rate"` // Share of the attempts finished in the last 24 hours that failed
+}
+
+// ClaimBudget returns how many jobs of the queue may be claimed now, given the
+// number of jobs already running, or -1 if there is no limit.
+func ClaimBudget(queue *database.WorkerQueue, running int64, now time.Time) int {
+	if queue.Paused {
+		return 0
+	}
+
+	budget := -1
+	if queue.MaxConcurrency > 0 {
+		budget = max(queue.MaxConcurrency-int(running), 0)
+	}
+	if queue.RateLimit > 0 {
+		_, started := currentRateWindow(queue, now)
+		left := max(queue.RateLimit-started, 0)
+		if budget < 0 || left < budget {
+			budget = left
+		}
+	}
+	return budget
+}
+
+// currentRateWindow returns the start of the rate limit window at now and the
+// number of jobs started in it
+func currentRateWindow(queue *database.WorkerQueue, now time.Time) (time.Time, int) {
+	if queue.RateWindowStart == nil || now.Sub(*queue.RateWindowStart) >= rateWindow {
+		return now, 0
+	}
+	return *queue.RateWindowStart, queue.RateWindowCount
+}
+
+// FailureRate returns the share of attempts that failed, or 0 without attempts
+func FailureRate(failed, finished int64) float64 {
+	if finished == 0 {
+		return 0
+	}
+	return float64(failed) / float64(finished)
+}
+
+// applyQueueDefaults sets the default priority and retries of the queue of the
+// job, if it has a queue
+func applyQueueDefaults(db *gorm.DB, job *database.WorkerJob) error {
+	var queues []database.WorkerQueue
+	if err := db.Where("job_type = ?", job.JobType).Limit(1).Find(&queues).Error; err != nil {
+		return err
+	}
+	if len(queues) == 0 {
+		return nil
+	}
+
+	if queues[0].DefaultPriority != nil {
+		job.Priority = *queues[0].DefaultPriority
+	}
+	if queues[0].DefaultMaxRetries != nil {
+		job.MaxRetries = *queues[0].DefaultMaxRetries
+	}
+	return nil
+}
+
+// UpdateQueue changes the settings of the queue of the job type, creating the
+// queue if it does not exist yet
+func (s *Service) UpdateQueue(jobType string, input QueueInput) (*database.WorkerQueue, error) {
+	var queue database.WorkerQueue
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&database.WorkerQueue{JobType: jobType}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+			First(&queue, "job_type = ?", jobType)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		updates := map[string]interface{}{
+			"updated_at": time.Now(),
+		}
+		if input.MaxConcurrency != nil {
+			updates["max_concurrency"] = *input.MaxConcurrency
+		}
+		if input.RateLimit != nil {
+			updates["rate_limit"] = *input.RateLimit
+		}
+		if input.DefaultPriority != nil {
+			updates["default_priority"] = *input.DefaultPriority
+		}
+		if input.DefaultMaxRetries != nil {
+			updates["default_max_retries"] = *input.DefaultMaxRetries
+		}
+		if input.Paused != nil {
+			updates["paused"] = *input.Paused
+		}
+
+		if err := tx.Model(&queue).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.First(&queue, "job_type = ?", jobType).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &queue, nil
+}
+
+// SetQueuePaused pauses or resumes the queue of the job type. Jobs of a paused
+// queue stay queued and running jobs are not affected.
+func (s *Service) SetQueuePaused(jobType string, paused bool) (*database.WorkerQueue, error) {
+	return s.UpdateQueue(jobType, QueueInput{Paused: &paused})
+}
+
+// GetQueues returns the status of every job type that has a queue or jobs
+// that are queued, running or recently attempted, by job type
+func (s *Service) GetQueues() ([]QueueStatus, error) {
+	var queues []database.WorkerQueue
+	if err := s.db.Find(&queues).Error; err != nil {
+		return nil, err
+	}
+
+	statuses := map[string]*QueueStatus{}
+	status := func(jobType string) *QueueStatus {
+		if statuses[jobType] == nil {
+			statuses[jobType] = &QueueStatus{WorkerQueue: database.WorkerQueue{JobType: jobType}}
+		}
+		return statuses[jobType]
+	}
+	for _, queue := range queues {
+		status(queue.JobType).WorkerQueue = queue
+	}
+
+	var counts []struct {
+		JobType string
+		Status  database.JobStatus
+		Count   int64
+	}
+	result := s.db.Model(&database.WorkerJob{}).
+		Select("job_type, status, COUNT(*) AS count").
+		Where("status IN ?", ActiveStatuses).
+		Group("job_type, status").
+		Scan(&counts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, count := range counts {
+		if count.Status == database.JobStatusRunning {
+			status(count.JobType).Running += count.Count
+		} else {
+			status(count.JobType).Depth += count.Count
+		}
+	}
+
+	var attempts []struct {
+		JobType  string
+		Failed   int64
+		Finished int64
+	}
+	result = s.db.Table("application.worker_job_attempts AS a").
+		Select("j.job_type, COUNT(*) FILTER (WHERE a.status = ?) AS failed, COUNT(*) AS finished", database.JobStatusFailed).
+		Joins("JOIN application.worker_jobs AS j ON j.id = a.job_id").
+		Where("a.finished_at > ?", time.Now().Add(-failureRateWindow)).
+		Group("j.job_type").
+		Scan(&attempts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, attempt := range attempts {
+		status(attempt.JobType).FailureRate = FailureRate(attempt.Failed, attempt.Finished)
+	}
+
+	list := make([]QueueStatus, 0, len(statuses))
+	for _, status := range statuses {
+		list = append(list, *status)
+	}
+	slices.SortFunc(list, func(a, b QueueStatus) int {
+		return strings.Compare(a.JobType, b.JobType)
+	})
+	return list, nil
+}
+
+// claimBudgets locks the queues of the job types and returns the claim budget
+// of every job type that is limited. Claims of limited job types are
+// serialized on the lock, so concurrent workers see each other's jobs.
+func claimBudgets(tx *gorm.DB, jobTypes []string, now time.Time) (map[string]int, []database.WorkerQueue, error) {
+	var queues []database.WorkerQueue
+	result := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Where("job_type IN ?", jobTypes).
+		Order("job_type ASC").
+		Find(&queues)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+
+	budgets := map[string]int{}
+	if len(queues) == 0 {
+		return budgets, queues, nil
+	}
+
+	var counts []struct {
+		JobType string
+		Count   int64
+	}
+	result = tx.Model(&database.WorkerJob{}).
+		Select("job_type, COUNT(*) AS count").
+		Where("job_type IN ? AND status = ?", jobTypes, database.JobStatusRunning).
+		Group("job_type").
+		Scan(&counts)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+
+	running := map[string]int64{}
+	for _, count := range counts {
+		running[count.JobType] = count.Count
+	}
+
+	for i := range queues {
+		if budget := ClaimBudget(&queues[i], running[queues[i].JobType], now); budget >= 0 {
+			budgets[queues[i].JobType] = budget
+		}
+	}
+	return budgets, queues, nil
+}
+
+// recordClaims counts the claimed jobs against the rate limits of the queues
+func recordClaims(tx *gorm.DB, queues []database.WorkerQueue, jobs []database.WorkerJob, now time.Time) error {
+	for i := range queues {
+		if queues[i].RateLimit <= 0 {
+			continue
+		}
+
+		claimed := 0
+		for j := range jobs {
+			if jobs[j].JobType == queues[i].JobType {
+				claimed++
+			}
+		}
+		if claimed == 0 {
+			continue
+		}
+
+		start, started := currentRateWindow(&queues[i], now)
+		result := tx.Model(&database.WorkerQueue{}).
+			Where("job_type = ?", queues[i].JobType).
+			Updates(map[string]interface{}{
+				"rate_window_start": start,
+				"rate_window_count": started + claimed,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"fundermaps/app/database"
+)
+
+func TestClaimBudget(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-30 * time.Second)
+	expired := now.Add(-2 * time.Minute)
+
+	testCases := []struct {
+		name     string
+		queue    database.WorkerQueue
+		running  int64
+		expected int
+	}{
+		{"unlimited", database.WorkerQueue{}, 10, -1},
+		{"paused", database.WorkerQueue{Paused: true}, 0, 0},
+		{"concurrency", database.WorkerQueue{MaxConcurrency: 4}, 1, 3},
+		{"concurrency full", database.WorkerQueue{MaxConcurrency: 4}, 5, 0},
+		{"rate without window", database.WorkerQueue{RateLimit: 10}, 0, 10},
+		{"rate in window", database.WorkerQueue{RateLimit: 10, RateWindowStart: &recent, RateWindowCount: 8}, 0, 2},
+		{"rate after window", database.WorkerQueue{RateLimit: 10, RateWindowStart: &expired, RateWindowCount: 10}, 0, 10},
+		{"lowest limit", database.WorkerQueue{MaxConcurrency: 4, RateLimit: 10, RateWindowStart: &recent, RateWindowCount: 9}, 0, 1},
+	}
+
+	for _, tc := range testCases {
+		if actual := ClaimBudget(&tc.queue, tc.running, now); actual != tc.expected {
+			t.Errorf("ClaimBudget(%s) = %d; want %d", tc.name, actual, tc.expected)
+		}
+	}
+}
+
+func TestFailureRate(t *testing.T) {
+	if rate := FailureRate(0, 0); rate != 0 {
+		t.Errorf("FailureRate(0, 0) = %v; want 0", rate)
+	}
+	if rate := FailureRate(1, 4); rate != 0.25 {
+		t.Errorf("FailureRate(1, 4) = %v; want 0.25", rate)
+	}
+}
@@ -0,0 +1,215 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"fundermaps/app/database"
+	"fundermaps/pkg/cron"
+)
+
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// ScheduleInput defines a recurring job
+type ScheduleInput struct {
+	Name     string
+	JobType  string
+	Payload  map[string]interface{}
+	Cron     string
+	Timezone string // Defaults to UTC
+}
+
+// NextRun returns the first time after t the cron expression matches in the
+// time zone
+func NextRun(expression string, timezone string, after time.Time) (time.Time, error) {
+	schedule, err := cron.Parse(expression)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression %q: %w", expression, err)
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time zone %q: %w", timezone, err)
+	}
+
+	next := schedule.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never matches", expression)
+	}
+	return next, nil
+}
+
+// EnsureSchedule creates the schedule if it does not exist yet. An existing
+// schedule is left alone, so changes made through the management API, such as
+// pausing it, survive a restart.
+func (s *Service) EnsureSchedule(input ScheduleInput) error {
+	if input.Timezone == "" {
+		input.Timezone = "UTC"
+	}
+
+	nextRunAt, err := NextRun(input.Cron, input.Timezone, time.Now())
+	if err != nil {
+		return err
+	}
+
+	schedule := database.WorkerSchedule{
+		Name:      input.Name,
+		JobType:   input.JobType,
+		Payload:   database.JSONObject(input.Payload),
+		Cron:      input.Cron,
+		Timezone:  input.Timezone,
+		NextRunAt: nextRunAt,
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&schedule).Error
+}
+
+// GetSchedules returns all schedules by name
+func (s *Service) GetSchedules() ([]database.WorkerSchedule, error) {
+	schedules := []database.WorkerSchedule{}
+	result := s.db.Order("name ASC").Find(&schedules)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return schedules, nil
+}
+
+// SetSchedulePaused pauses or resumes a schedule. A resumed schedule continues
+// at its next match from now on; runs missed while paused are skipped.
+func (s *Service) SetSchedulePaused(name string, paused bool) (*database.WorkerSchedule, error) {
+	var schedule database.WorkerSchedule
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+			First(&schedule, "name = ?", name)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return ErrScheduleNotFound
+			}
+			return result.Error
+		}
+
+		updates := map[string]interface{}{
+			"paused":     paused,
+			"updated_at": time.Now(),
+		}
+		if !paused && schedule.Paused {
+			nextRunAt, err := NextRun(schedule.Cron, schedule.Timezone, time.Now())
+			if err != nil {
+				return err
+			}
+			updates["next_run_at"] = nextRunAt
+			schedule.NextRunAt = nextRunAt
+		}
+
+		schedule.Paused = paused
+		return tx.Model(&schedule).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// TriggerSchedule enqueues the job of the schedule right away. The regular
+// runs of the schedule are not affected.
+func (s *Service) TriggerSchedule(name string) (*database.WorkerJob, error) {
+	var schedule database.WorkerSchedule
+	result := s.db.First(&schedule, "name = ?", name)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrScheduleNotFound
+		}
+		return nil, result.Error
+	}
+
+	job, _, err := s.CreateJob(CreateJobInput{
+		JobType: schedule.JobType,
+		Payload: schedule.Payload,
+	})
+	return job, err
+}
+
+// EnqueueDueSchedules enqueues a job for every active schedule whose next run
+// has passed and moves the schedule to its next match. Schedules are locked
+// while they are handled and locked rows are skipped, so with several
+// schedulers running each tick is enqueued once. After downtime a schedule
+// runs once to catch up, not once for every missed tick.
+func (s *Service) EnqueueDueSchedules() (int, error) {
+	count := 0
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var schedules []database.WorkerSchedule
+		result := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+			Where("paused = false AND next_run_at <= ?", time.Now()).
+			Find(&schedules)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		for _, schedule := range schedules {
+			updates := map[string]interface{}{
+				"last_run_at": schedule.NextRunAt,
+				"updated_at":  time.Now(),
+			}
+
+			nextRunAt, err := NextRun(schedule.Cron, schedule.Timezone, time.Now())
+			if err != nil {
+				// Stop a broken schedule instead of failing every tick
+				log.Printf("Pausing schedule %s: %v", schedule.Name, err)
+				updates["paused"] = true
+			} else {
+				job := database.WorkerJob{
+					JobType:    schedule.JobType,
+					Payload:    schedule.Payload,
+					Status:     database.JobStatusPending,
+					MaxRetries: DefaultMaxRetries,
+				}
+				if err := applyQueueDefaults(tx, &job); err != nil {
+					return err
+				}
+				if err := tx.Create(&job).Error; err != nil {
+					return err
+				}
+
+				updates["next_run_at"] = nextRunAt
+				updates["last_job_id"] = job.ID
+				count++
+			}
+
+			if err := tx.Model(&database.WorkerSchedule{}).Where("name = ?", schedule.Name).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// RunScheduler enqueues due schedules every interval until ctx is cancelled
+func (s *Service) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if count, err := s.EnqueueDueSchedules(); err != nil {
+			log.Printf("Failed to enqueue scheduled jobs: %v", err)
+		} else if count > 0 {
+			log.Printf("Enqueued %d scheduled jobs", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,14 +1,47 @@
 package job
 
 import (
+	"errors"
+	"slices"
+	"strconv"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"fundermaps/app/config"
 	"fundermaps/app/database"
 )
 
+var (
+	ErrJobNotCancellable = errors.New("only pending or retrying jobs can be cancelled")
+	ErrJobNotRetryable   = errors.New("only dead or failed jobs can be retried")
+	ErrJobNotFinished    = errors.New("only finished jobs can be purged")
+	ErrDuplicateJob      = errors.New("a job with the same dedup key is already queued or running")
+)
+
+// ActiveStatuses are the statuses of jobs that are queued or running. Only one
+// job per dedup key can be active.
+var ActiveStatuses = []database.JobStatus{database.JobStatusPending, database.JobStatusRetry, database.JobStatusRunning}
+
+// JobTypeSendEmail is the job type of templated emails sent by the worker
+const JobTypeSendEmail = "send_email"
+
+// DefaultMaxRetries is used when neither the input nor the queue of the job
+// sets the number of retries
+const DefaultMaxRetries = 3
+
+// RetryableStatuses are the statuses of jobs that can be requeued by hand
+var RetryableStatuses = []database.JobStatus{database.JobStatusDead, database.JobStatusFailed}
+
+// FinishedStatuses are the statuses of jobs that will not run again on their own
+var FinishedStatuses = []database.JobStatus{
+	database.JobStatusComplete,
+	database.JobStatusFailed,
+	database.JobStatusCancelled,
+	database.JobStatusDead,
+}
+
 // Service handles business logic for worker jobs
 type Service struct {
 	db  *gorm.DB
@@ -28,40 +61,73 @@ type CreateJobInput struct {
 	JobType      string                 `json:"job_type" validate:"required"`
 	Payload      map[string]interface{} `json:"payload"`
 	Priority     *int                   `json:"priority"`
-	MaxRetries   *int                   `json:"max_retries"`
+	MaxRetries   *int                   `json:"max_retries" validate:"omitempty,min=0"`
 	ProcessAfter *time.Time             `json:"process_after"`
+	DedupKey     *string                `json:"dedup_key" validate:"omitempty,min=1,max=255"`
 }
 
-// CreateJob creates a new worker job with the provided input
-func (s *Service) CreateJob(input CreateJobInput) (*database.WorkerJob, error) {
+// CreateJob creates a new worker job with the provided input. When a dedup key
+// is given and a job with the same key is queued, running or completed within
+// the dedup window, that job is returned instead and created is false.
+func (s *Service) CreateJob(input CreateJobInput) (job *database.WorkerJob, created bool, err error) {
 	// Create a new job with default values
-	job := database.WorkerJob{
+	newJob := database.WorkerJob{
 		JobType:    input.JobType,
 		Payload:    database.JSONObject(input.Payload),
 		Status:     database.JobStatusPending,
 		RetryCount: 0,
+		MaxRetries: DefaultMaxRetries,
+		DedupKey:   input.DedupKey,
+	}
+
+	if err := applyQueueDefaults(s.db, &newJob); err != nil {
+		return nil, false, err
 	}
 
 	// Set optional fields if provided
 	if input.Priority != nil {
-		job.Priority = *input.Priority
+		newJob.Priority = *input.Priority
 	}
 
 	if input.MaxRetries != nil {
-		job.MaxRetries = *input.MaxRetries
+		newJob.MaxRetries = *input.MaxRetries
 	}
 
 	if input.ProcessAfter != nil {
-		job.ProcessAfter = input.ProcessAfter
+		newJob.ProcessAfter = input.ProcessAfter
 	}
 
-	// Create the job in the database
-	result := s.db.Create(&job)
-	if result.Error != nil {
-		return nil, result.Error
+	if input.DedupKey == nil {
+		result := s.db.Create(&newJob)
+		if result.Error != nil {
+			return nil, false, result.Error
+		}
+		return &newJob, true, nil
 	}
 
-	return &job, nil
+	// A concurrent create can win the unique index between the lookup and the
+	// insert, after which the lookup finds its job. The job it conflicted with
+	// can finish in between as well, hence the loop.
+	for range 3 {
+		existing, err := s.findDuplicateJob(*input.DedupKey)
+		if err != nil {
+			return nil, false, err
+		}
+		if existing != nil {
+			return existing, false, nil
+		}
+
+		result := s.db.Clauses(dedupConflict).Create(&newJob)
+		if result.Error != nil {
+			return nil, false, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return &newJob, true, nil
+		}
+		newJob.ID = 0
+	}
+
+	return nil, false, ErrDuplicateJob
 }
 
 // GetAllJobsOptions defines options for filtering jobs
@@ -111,7 +177,7 @@ func (s *Service) GetAllJobs(options GetAllJobsOptions) ([]database.WorkerJob, e
 // GetJobByID retrieves a specific job by ID
 func (s *Service) GetJobByID(jobID string) (*database.WorkerJob, error) {
 	var job database.WorkerJob
-	result := s.db.First(&job, jobID)
+	result := s.db.First(&job, "id = ?", jobID)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -119,33 +185,143 @@ func (s *Service) GetJobByID(jobID string) (*database.WorkerJob, error) {
 	return &job, nil
 }
 
-// CancelJob cancels a job by changing its status to failed
+// CancelJob cancels a pending or retrying job
 func (s *Service) CancelJob(jobID string) (*database.WorkerJob, error) {
 	var job database.WorkerJob
-	result := s.db.First(&job, jobID)
+	result := s.db.First(&job, "id = ?", jobID)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
-	// Can only cancel pending or retry jobs
-	if job.Status != database.JobStatusPending && job.Status != database.JobStatusRetry {
-		return nil, gorm.ErrInvalidValue // Use a more specific error type in production
+	result = s.db.Model(&job).
+		Where("status IN ?", []database.JobStatus{database.JobStatusPending, database.JobStatusRetry}).
+		Updates(map[string]interface{}{
+			"status":     database.JobStatusCancelled,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrJobNotCancellable
 	}
 
-	// Update the job status to failed
-	cancelReason := "Cancelled by admin"
-	job.Status = database.JobStatusFailed
-	job.LastError = &cancelReason
-	job.UpdatedAt = time.Now()
+	job.Status = database.JobStatusCancelled
+	return &job, nil
+}
 
-	result = s.db.Save(&job)
+// RequeueJob puts a dead or failed job back on the queue with a fresh set of
+// retries. The attempt history is kept.
+func (s *Service) RequeueJob(jobID string) (*database.WorkerJob, error) {
+	var job database.WorkerJob
+	result := s.db.First(&job, "id = ?", jobID)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
+	if job.DedupKey != nil && slices.Contains(RetryableStatuses, job.Status) {
+		var active int64
+		result = s.db.Model(&database.WorkerJob{}).
+			Where("dedup_key = ? AND status IN ?", *job.DedupKey, ActiveStatuses).
+			Count(&active)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if active > 0 {
+			return nil, ErrDuplicateJob
+		}
+	}
+
+	// A job with the key may become active after the check, which the unique
+	// index rejects
+	result = s.db.Model(&job).
+		Where("status IN ?", RetryableStatuses).
+		Updates(map[string]interface{}{
+			"status":        database.JobStatusPending,
+			"retry_count":   0,
+			"process_after": nil,
+			"updated_at":    time.Now(),
+		})
+	if result.Error != nil {
+		if isUniqueViolation(result.Error) {
+			return nil, ErrDuplicateJob
+		}
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrJobNotRetryable
+	}
+
+	job.Status = database.JobStatusPending
+	job.RetryCount = 0
+	job.ProcessAfter = nil
 	return &job, nil
 }
 
+// RequeueJobs requeues all dead or failed jobs matching the filter and returns
+// how many were requeued. An empty job type matches every type; the status
+// must be one of RetryableStatuses. Of the jobs sharing a dedup key only the
+// latest is requeued, and none if another job with the key is still active.
+func (s *Service) RequeueJobs(jobType string, status database.JobStatus) (int64, error) {
+	if !slices.Contains(RetryableStatuses, status) {
+		return 0, ErrJobNotRetryable
+	}
+
+	query := s.db.Model(&database.WorkerJob{}).Where("status = ?", status)
+	if jobType != "" {
+		query = query.Where("job_type = ?", jobType)
+	}
+
+	latest := s.db.Model(&database.WorkerJob{}).Select("MAX(id)").
+		Where("status = ? AND dedup_key IS NOT NULL", status).
+		Group("dedup_key")
+	active := s.db.Model(&database.WorkerJob{}).Select("dedup_key").
+		Where("status IN ? AND dedup_key IS NOT NULL", ActiveStatuses)
+	query = query.Where("dedup_key IS NULL OR (id IN (?) AND dedup_key NOT IN (?))", latest, active)
+
+	result := query.Updates(map[string]interface{}{
+		"status":        database.JobStatusPending,
+		"retry_count":   0,
+		"process_after": nil,
+		"updated_at":    time.Now(),
+	})
+	if result.Error != nil && isUniqueViolation(result.Error) {
+		return 0, ErrDuplicateJob
+	}
+	return result.RowsAffected, result.Error
+}
+
+// PurgeJobs deletes finished jobs matching the filter, together with their
+// attempt history, and returns how many were deleted. An empty job type
+// matches every type; the status must be one of FinishedStatuses.
+func (s *Service) PurgeJobs(jobType string, status database.JobStatus) (int64, error) {
+	if !slices.Contains(FinishedStatuses, status) {
+		return 0, ErrJobNotFinished
+	}
+
+	var count int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		jobs := tx.Model(&database.WorkerJob{}).Select("id").Where("status = ?", status)
+		if jobType != "" {
+			jobs = jobs.Where("job_type = ?", jobType)
+		}
+
+		if err := tx.Where("job_id IN (?)", jobs).Delete(&database.WorkerJobAttempt{}).Error; err != nil {
+			return err
+		}
+
+		query := tx.Where("status = ?", status)
+		if jobType != "" {
+			query = query.Where("job_type = ?", jobType)
+		}
+
+		result := query.Delete(&database.WorkerJob{})
+		count = result.RowsAffected
+		return result.Error
+	})
+	return count, err
+}
+
 // UpdateJobStatus updates the status of a job
 func (s *Service) UpdateJobStatus(jobID string, status database.JobStatus) error {
 	result := s.db.Model(&database.WorkerJob{}).Where("id = ?", jobID).Update("status", status)
@@ -197,6 +373,19 @@ func (s *Service) MarkJobAsComplete(jobID string) error {
 		Where("id = ?", jobID).
 		Updates(map[string]interface{}{
 			"status":     database.JobStatusComplete,
+			"progress":   100,
+			"updated_at": time.Now(),
+		})
+	return result.Error
+}
+
+// MarkJobAsDead marks a job that used up its retries as dead
+func (s *Service) MarkJobAsDead(jobID string, errorMsg string) error {
+	result := s.db.Model(&database.WorkerJob{}).
+		Where("id = ?", jobID).
+		Updates(map[string]interface{}{
+			"status":     database.JobStatusDead,
+			"last_error": errorMsg,
 			"updated_at": time.Now(),
 		})
 	return result.Error
@@ -213,3 +402,171 @@ func (s *Service) MarkJobAsFailed(jobID string, errorMsg string) error {
 		})
 	return result.Error
 }
+
+// ClaimJobs atomically claims up to limit runnable jobs of the given types and
+// marks them as running. Rows locked by another worker are skipped, so several
+// worker replicas can poll the same queue without picking up the same job.
+// Jobs of paused queues are left alone and queues with a concurrency or rate
+// limit get no more jobs than their limit allows.
+func (s *Service) ClaimJobs(jobTypes []string, limit int) ([]database.WorkerJob, error) {
+	var jobs []database.WorkerJob
+
+	if len(jobTypes) == 0 {
+		return jobs, nil
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		budgets, queues, err := claimBudgets(tx, jobTypes, now)
+		if err != nil {
+			return err
+		}
+
+		runnable := func(n int) *gorm.DB {
+			return tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+				Where("status IN ? AND (process_after IS NULL OR process_after <= ?)",
+					[]database.JobStatus{database.JobStatusPending, database.JobStatusRetry},
+					now).
+				Order("priority DESC, created_at ASC").
+				Limit(n)
+		}
+
+		unlimited := slices.DeleteFunc(slices.Clone(jobTypes), func(jobType string) bool {
+			_, limited := budgets[jobType]
+			return limited
+		})
+		if len(unlimited) > 0 {
+			if err := runnable(limit).Where("job_type IN ?", unlimited).Find(&jobs).Error; err != nil {
+				return err
+			}
+		}
+
+		// Limited job types are claimed separately, so a full queue cannot
+		// take the place of the jobs of other types
+		for jobType, budget := range budgets {
+			if budget == 0 {
+				continue
+			}
+
+			var limitedJobs []database.WorkerJob
+			if err := runnable(min(budget, limit)).Where("job_type = ?", jobType).Find(&limitedJobs).Error; err != nil {
+				return err
+			}
+			jobs = append(jobs, limitedJobs...)
+		}
+
+		// Jobs over the limit are not claimed and their locks are released
+		// on commit
+		slices.SortStableFunc(jobs, func(a, b database.WorkerJob) int {
+			if a.Priority != b.Priority {
+				return b.Priority - a.Priority
+			}
+			return a.CreatedAt.Compare(b.CreatedAt)
+		})
+		if len(jobs) > limit {
+			jobs = jobs[:limit]
+		}
+
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		if err := recordClaims(tx, queues, jobs, now); err != nil {
+			return err
+		}
+
+		jobIDs := make([]int64, len(jobs))
+		for i := range jobs {
+			jobIDs[i] = jobs[i].ID
+		}
+
+		// Progress is reported per attempt and starts over
+		result := tx.Model(&database.WorkerJob{}).
+			Where("id IN ?", jobIDs).
+			Updates(map[string]interface{}{
+				"status":           database.JobStatusRunning,
+				"progress":         0,
+				"progress_message": nil,
+				"updated_at":       now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		for i := range jobs {
+			jobs[i].Status = database.JobStatusRunning
+			jobs[i].Progress = 0
+			jobs[i].ProgressMessage = nil
+			jobs[i].UpdatedAt = now
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// RetryJob records a failed attempt. The job is rescheduled with exponential
+// backoff until it has used up MaxRetries, after which it is dead.
+func (s *Service) RetryJob(job *database.WorkerJob, errorMsg string) error {
+	if job.RetryCount >= job.MaxRetries {
+		return s.MarkJobAsDead(strconv.FormatInt(job.ID, 10), errorMsg)
+	}
+
+	processAfter := time.Now().Add(RetryBackoff(job.RetryCount))
+
+	result := s.db.Model(&database.WorkerJob{}).
+		Where("id = ?", job.ID).
+		Updates(map[string]interface{}{
+			"status":        database.JobStatusRetry,
+			"retry_count":   gorm.Expr("retry_count + 1"),
+			"last_error":    errorMsg,
+			"process_after": processAfter,
+			"updated_at":    time.Now(),
+		})
+	return result.Error
+}
+
+// RequeueStaleJobs puts jobs that have been running for longer than timeout
+// back on the queue. This recovers jobs claimed by a worker that crashed or
+// was killed before it could report the outcome. The lost run counts as an
+// attempt, so a job that keeps taking down its worker eventually dies.
+func (s *Service) RequeueStaleJobs(timeout time.Duration) (int64, error) {
+	const reason = "Worker stopped responding"
+
+	cutoff := time.Now().Add(-timeout)
+
+	var count int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		staleJobs := tx.Model(&database.WorkerJob{}).
+			Select("id").
+			Where("status = ? AND updated_at < ?", database.JobStatusRunning, cutoff)
+
+		if err := tx.Model(&database.WorkerJobAttempt{}).
+			Where("job_id IN (?) AND finished_at IS NULL", staleJobs).
+			Updates(map[string]interface{}{
+				"status":      database.JobStatusFailed,
+				"error":       reason,
+				"finished_at": time.Now(),
+			}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&database.WorkerJob{}).
+			Where("status = ? AND updated_at < ?", database.JobStatusRunning, cutoff).
+			Updates(map[string]interface{}{
+				"status":      gorm.Expr("CASE WHEN retry_count >= max_retries THEN ?::application.job_status ELSE ?::application.job_status END", database.JobStatusDead, database.JobStatusRetry),
+				"retry_count": gorm.Expr("retry_count + 1"),
+				"last_error":  reason,
+				"updated_at":  time.Now(),
+			})
+		count = result.RowsAffected
+		return result.Error
+	})
+	return count, err
+}
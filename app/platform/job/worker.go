@@ -0,0 +1,243 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"fundermaps/app/database"
+)
+
+const (
+	retryBackoffBase = 30 * time.Second
+	retryBackoffMax  = time.Hour
+)
+
+// Handler processes a single worker job. Returning an error marks the attempt
+// as failed and schedules a retry if the job has retries left.
+type Handler func(ctx context.Context, job *database.WorkerJob) error
+
+// Registry maps job types to the handler that processes them
+type Registry struct {
+	handlers map[string]Handler
+}
+
+// NewRegistry creates an empty handler registry
+func NewRegistry() *Registry {
+	return &Registry{
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Register adds a handler for the given job type, replacing any existing one
+func (r *Registry) Register(jobType string, handler Handler) {
+	r.handlers[jobType] = handler
+}
+
+// Handler returns the handler registered for the given job type
+func (r *Registry) Handler(jobType string) (Handler, bool) {
+	handler, ok := r.handlers[jobType]
+	return handler, ok
+}
+
+// JobTypes returns the sorted list of job types with a registered handler
+func (r *Registry) JobTypes() []string {
+	jobTypes := make([]string, 0, len(r.handlers))
+	for jobType := range r.handlers {
+		jobTypes = append(jobTypes, jobType)
+	}
+	slices.Sort(jobTypes)
+	return jobTypes
+}
+
+// RetryBackoff returns the delay before the next attempt of a job that has
+// already been retried retryCount times. The delay doubles with every retry
+// and is capped at one hour.
+func RetryBackoff(retryCount int) time.Duration {
+	backoff := retryBackoffBase
+	for range retryCount {
+		backoff *= 2
+		if backoff >= retryBackoffMax {
+			return retryBackoffMax
+		}
+	}
+	return backoff
+}
+
+// WorkerOptions configures a Worker
+type WorkerOptions struct {
+	ID              string
+	Concurrency     int
+	PollInterval    time.Duration
+	JobTimeout      time.Duration
+	ShutdownTimeout time.Duration
+}
+
+// Worker claims jobs from the queue and dispatches them to their handlers
+type Worker struct {
+	service  *Service
+	registry *Registry
+	options  WorkerOptions
+}
+
+// NewWorker creates a new worker for the jobs in the registry
+func NewWorker(service *Service, registry *Registry, options WorkerOptions) *Worker {
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = 5 * time.Second
+	}
+	if options.JobTimeout <= 0 {
+		options.JobTimeout = 30 * time.Minute
+	}
+	if options.ShutdownTimeout <= 0 {
+		options.ShutdownTimeout = 30 * time.Second
+	}
+
+	return &Worker{
+		service:  service,
+		registry: registry,
+		options:  options,
+	}
+}
+
+// Run polls the queue until ctx is cancelled. On shutdown no new jobs are
+// claimed and running jobs get ShutdownTimeout to finish before their context
+// is cancelled. Run returns once all running jobs have reported back.
+func (w *Worker) Run(ctx context.Context) error {
+	jobTypes := w.registry.JobTypes()
+	log.Printf("Worker %s started for job types %v", w.options.ID, jobTypes)
+
+	// Jobs run on their own context so a shutdown signal does not abort them
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, w.options.Concurrency)
+
+	ticker := time.NewTicker(w.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if count, err := w.service.RequeueStaleJobs(2 * w.options.JobTimeout); err != nil {
+			log.Printf("Failed to requeue stale jobs: %v", err)
+		} else if count > 0 {
+			log.Printf("Requeued %d stale jobs", count)
+		}
+
+		for ctx.Err() == nil {
+			free := cap(slots) - len(slots)
+			if free == 0 {
+				break
+			}
+
+			jobs, err := w.service.ClaimJobs(jobTypes, free)
+			if err != nil {
+				log.Printf("Failed to claim jobs: %v", err)
+				break
+			}
+
+			for i := range jobs {
+				slots <- struct{}{}
+				wg.Add(1)
+				go func(job database.WorkerJob) {
+					defer func() {
+						<-slots
+						wg.Done()
+					}()
+					w.process(jobCtx, &job)
+				}(jobs[i])
+			}
+
+			// Keep draining the queue while it yields full batches
+			if len(jobs) < free {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Worker %s shutting down, waiting for running jobs", w.options.ID)
+			w.wait(&wg, cancelJobs)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// wait blocks until all running jobs are done. Jobs still running after the
+// shutdown timeout are cancelled and waited for once more.
+func (w *Worker) wait(wg *sync.WaitGroup, cancelJobs context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(w.options.ShutdownTimeout):
+		log.Printf("Shutdown timeout reached, cancelling running jobs")
+		cancelJobs()
+		<-done
+	}
+}
+
+func (w *Worker) process(ctx context.Context, job *database.WorkerJob) {
+	jobID := strconv.FormatInt(job.ID, 10)
+
+	handler, ok := w.registry.Handler(job.JobType)
+	if !ok {
+		if err := w.service.MarkJobAsFailed(jobID, fmt.Sprintf("No handler registered for job type %q", job.JobType)); err != nil {
+			log.Printf("Failed to mark job %d as failed: %v", job.ID, err)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.options.JobTimeout)
+	defer cancel()
+
+	attempt, err := w.service.StartAttempt(job, w.options.ID)
+	if err != nil {
+		log.Printf("Failed to record attempt of job %d: %v", job.ID, err)
+	}
+
+	start := time.Now()
+	err = runHandler(withReporter(ctx, w.service, job.ID), handler, job)
+	if attempt != nil {
+		if err := w.service.FinishAttempt(attempt, err); err != nil {
+			log.Printf("Failed to record outcome of job %d: %v", job.ID, err)
+		}
+	}
+	if err != nil {
+		log.Printf("Job %d (%s) failed after %s: %v", job.ID, job.JobType, time.Since(start), err)
+		if err := w.service.RetryJob(job, err.Error()); err != nil {
+			log.Printf("Failed to record failure of job %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	log.Printf("Job %d (%s) completed in %s", job.ID, job.JobType, time.Since(start))
+	if err := w.service.MarkJobAsComplete(jobID); err != nil {
+		log.Printf("Failed to mark job %d as complete: %v", job.ID, err)
+	}
+}
+
+// runHandler calls the handler and turns a panic into an error so a single
+// misbehaving job cannot take down the worker.
+func runHandler(ctx context.Context, handler Handler, job *database.WorkerJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %d panicked: %v\n%s", job.ID, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return handler(ctx, job)
+}
@@ -0,0 +1,61 @@
+package job
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	testCases := []struct {
+		retryCount int
+		expected   time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{5, 16 * time.Minute},
+		{7, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, tc := range testCases {
+		actual := RetryBackoff(tc.retryCount)
+		if actual != tc.expected {
+			t.Errorf("RetryBackoff(%d) = %v; want %v", tc.retryCount, actual, tc.expected)
+		}
+	}
+}
+
+func TestRegistryJobTypes(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("send_email", nil)
+	registry.Register("export", nil)
+
+	jobTypes := registry.JobTypes()
+	if len(jobTypes) != 2 || jobTypes[0] != "export" || jobTypes[1] != "send_email" {
+		t.Errorf("JobTypes() = %v; want [export send_email]", jobTypes)
+	}
+
+	if _, ok := registry.Handler("unknown"); ok {
+		t.Errorf("Handler(%q) found; want not found", "unknown")
+	}
+}
+
+func TestClampProgress(t *testing.T) {
+	testCases := []struct {
+		percent  int
+		expected int
+	}{
+		{-10, 0},
+		{0, 0},
+		{42, 42},
+		{100, 100},
+		{250, 100},
+	}
+
+	for _, tc := range testCases {
+		if actual := ClampProgress(tc.percent); actual != tc.expected {
+			t.Errorf("ClampProgress(%d) = %d; want %d", tc.percent, actual, tc.expected)
+		}
+	}
+}
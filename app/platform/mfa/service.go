@@ -0,0 +1,231 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"fundermaps/app/database"
+	"fundermaps/pkg/utils"
+)
+
+const (
+	Issuer = "FunderMaps"
+
+	RecoveryCodeCount    = 10
+	ChallengeExpiration  = 5 * time.Minute
+	MaxChallengeAttempts = 5
+)
+
+var (
+	ErrAlreadyEnabled   = errors.New("mfa already enabled")
+	ErrNotEnrolled      = errors.New("mfa not enrolled")
+	ErrInvalidCode      = errors.New("invalid mfa code")
+	ErrInvalidChallenge = errors.New("invalid mfa challenge")
+)
+
+// Service manages TOTP based two-factor authentication. Enrolment happens in
+// two steps: Enroll stores a new secret, and Enable turns MFA on once the user
+// proves their authenticator produces valid codes.
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new MFA service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Enroll generates a new TOTP secret for the user and returns it together with
+// the otpauth:// URI for authenticator apps
+func (s *Service) Enroll(user *database.User) (string, string, error) {
+	if user.MFAEnabled {
+		return "", "", ErrAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.db.Model(user).Update("mfa_secret", secret).Error; err != nil {
+		return "", "", err
+	}
+
+	return secret, utils.TOTPURI(Issuer, user.Email, secret), nil
+}
+
+// Enable turns on MFA after checking the code against the enrolled secret.
+// Returns a fresh set of recovery codes, which are only stored hashed.
+func (s *Service) Enable(user *database.User, code string) ([]string, error) {
+	if user.MFAEnabled {
+		return nil, ErrAlreadyEnabled
+	}
+	if user.MFASecret == nil {
+		return nil, ErrNotEnrolled
+	}
+	step, ok := utils.MatchTOTP(*user.MFASecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	recoveryCodes := make([]database.MFARecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		recoveryCodes[i] = database.MFARecoveryCode{
+			UserID:   user.ID,
+			CodeHash: hashRecoveryCode(code),
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&database.MFARecoveryCode{}, "user_id = ?", user.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&recoveryCodes).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]any{"mfa_enabled": true, "mfa_last_step": step}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable turns off MFA and removes the secret and recovery codes
+func (s *Service) Disable(userID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&database.MFARecoveryCode{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&database.MFAChallenge{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&database.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]any{"mfa_secret": nil, "mfa_enabled": false, "mfa_last_step": nil}).Error
+	})
+}
+
+// Verify checks a TOTP code. If the code is not a valid TOTP code it is tried
+// as a recovery code, which is consumed on success. A TOTP code is accepted
+// once: its time step must be later than that of the last accepted code.
+func (s *Service) Verify(user *database.User, code string) (bool, error) {
+	if !user.MFAEnabled || user.MFASecret == nil {
+		return false, ErrNotEnrolled
+	}
+
+	if step, ok := utils.MatchTOTP(*user.MFASecret, code, time.Now()); ok {
+		result := s.db.Model(&database.User{}).
+			Where("id = ? AND (mfa_last_step IS NULL OR mfa_last_step < ?)", user.ID, step).
+			Update("mfa_last_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return result.RowsAffected == 1, nil
+	}
+
+	result := s.db.Model(&database.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CreateChallenge starts the second step of a sign in. Only the hash of the
+// challenge token is stored.
+func (s *Service) CreateChallenge(userID uuid.UUID) (string, error) {
+	token := fmt.Sprintf("fmmc%s", utils.GenerateRandomString(40))
+
+	challenge := database.MFAChallenge{
+		Token:     utils.HashToken(token),
+		UserID:    userID,
+		ExpiredAt: time.Now().Add(ChallengeExpiration),
+	}
+	if err := s.db.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// VerifyChallenge checks the code for the user the challenge was issued to.
+// Every attempt is claimed before the code is checked, so parallel requests
+// cannot exceed MaxChallengeAttempts. The challenge is consumed on success,
+// by exactly one request, and after too many failed attempts. On
+// ErrInvalidCode the user is returned so the caller can count the failure.
+func (s *Service) VerifyChallenge(token string, code string) (*database.User, error) {
+	tokenHash := utils.HashToken(token)
+
+	var challenge database.MFAChallenge
+	result := s.db.Model(&challenge).
+		Clauses(clause.Returning{}).
+		Where("token = ? AND expired_at > now() AND attempts < ?", tokenHash, MaxChallengeAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Expired or out of attempts
+		if err := s.db.Delete(&database.MFAChallenge{}, "token = ?", tokenHash).Error; err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidChallenge
+	}
+
+	var user database.User
+	if err := s.db.First(&user, "id = ?", challenge.UserID).Error; err != nil {
+		return nil, err
+	}
+
+	ok, err := s.Verify(&user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &user, ErrInvalidCode
+	}
+
+	result = s.db.Delete(&database.MFAChallenge{}, "token = ?", tokenHash)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return nil, ErrInvalidChallenge
+	}
+	return &user, nil
+}
+
+// generateRecoveryCode returns a random code formatted as xxxx-xxxx-xxxx-xxxx
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+	return fmt.Sprintf("%s-%s-%s-%s", code[0:4], code[4:8], code[8:12], code[12:16]), nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,51 @@
+package oauth
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// MatchRedirectURI reports whether the redirect URI exactly matches one of the
+// registered redirect URIs. For loopback redirect URIs the port is ignored, as
+// native apps listen on an ephemeral port (RFC 8252, section 7.3).
+func MatchRedirectURI(registered []string, redirectURI string) bool {
+	for _, r := range registered {
+		if r == redirectURI || matchLoopback(r, redirectURI) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchLoopback(registered string, redirectURI string) bool {
+	r, err := url.Parse(registered)
+	if err != nil || r.Scheme != "http" || !isLoopback(r.Hostname()) {
+		return false
+	}
+
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return false
+	}
+
+	return u.Scheme == r.Scheme &&
+		u.Hostname() == r.Hostname() &&
+		u.User == nil &&
+		u.Path == r.Path &&
+		u.RawQuery == r.RawQuery &&
+		u.Fragment == ""
+}
+
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// IsLocalRedirect reports whether the URL is a path on this host. Used for
+// redirects outside an OAuth2 flow, which are never sent to another host.
+func IsLocalRedirect(redirectURL string) bool {
+	return strings.HasPrefix(redirectURL, "/") &&
+		!strings.HasPrefix(redirectURL, "//") &&
+		!strings.HasPrefix(redirectURL, "/\\")
+}
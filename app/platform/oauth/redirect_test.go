@@ -0,0 +1,56 @@
+package oauth
+
+import "testing"
+
+func TestMatchRedirectURI(t *testing.T) {
+	registered := []string{
+		"https://app.fundermaps.com/callback",
+		"http://127.0.0.1/callback",
+		"http://[::1]:8080/callback",
+	}
+
+	testCases := []struct {
+		redirectURI string
+		expected    bool
+	}{
+		{"https://app.fundermaps.com/callback", true},
+		{"https://app.fundermaps.com/callback/", false},
+		{"https://app.fundermaps.com/callback?next=/", false},
+		{"https://app.fundermaps.com:8443/callback", false},
+		{"https://evil.com/callback", false},
+		{"http://127.0.0.1:51004/callback", true},
+		{"http://127.0.0.1/callback", true},
+		{"http://127.0.0.1:51004/other", false},
+		{"https://127.0.0.1:51004/callback", false},
+		{"http://[::1]:60123/callback", true},
+		{"http://localhost:51004/callback", false},
+		{"", false},
+	}
+
+	for _, tc := range testCases {
+		if result := MatchRedirectURI(registered, tc.redirectURI); result != tc.expected {
+			t.Errorf("MatchRedirectURI(%q) = %v, want %v", tc.redirectURI, result, tc.expected)
+		}
+	}
+}
+
+func TestIsLocalRedirect(t *testing.T) {
+	testCases := []struct {
+		redirectURL string
+		expected    bool
+	}{
+		{"/", true},
+		{"/dashboard?tab=1", true},
+		{"//evil.com", false},
+		{"/\\evil.com", false},
+		{"https://evil.com", false},
+		{"dashboard", false},
+		{"", false},
+	}
+
+	for _, tc := range testCases {
+		if result := IsLocalRedirect(tc.redirectURL); result != tc.expected {
+			t.Errorf("IsLocalRedirect(%q) = %v, want %v", tc.redirectURL, result, tc.expected)
+		}
+	}
+}
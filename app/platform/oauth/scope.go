@@ -0,0 +1,149 @@
+package oauth
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"fundermaps/app/platform/oidc"
+)
+
+// Scopes that grant access to the API
+const (
+	ScopeUserRead    = "user:read"
+	ScopeUserWrite   = "user:write"
+	ScopeProductRead = "product:read"
+	ScopeReportRead  = "report:read"
+	ScopeReportWrite = "report:write"
+	ScopeMapsetRead  = "mapset:read"
+	ScopeManagement  = "management"
+
+	// ScopeUnrestricted is only issued to the first-party sign-in and covers
+	// every scope. Clients cannot request it.
+	ScopeUnrestricted = "*"
+)
+
+// SupportedScopes lists every scope a client can request
+var SupportedScopes = []string{
+	oidc.ScopeOpenID,
+	oidc.ScopeProfile,
+	oidc.ScopeEmail,
+	ScopeUserRead,
+	ScopeUserWrite,
+	ScopeProductRead,
+	ScopeReportRead,
+	ScopeReportWrite,
+	ScopeMapsetRead,
+	ScopeManagement,
+}
+
+// DefaultScopes are allowed to applications without allowed scopes of their
+// own. Management is never allowed by default.
+var DefaultScopes = []string{
+	oidc.ScopeOpenID,
+	oidc.ScopeProfile,
+	oidc.ScopeEmail,
+	ScopeUserRead,
+	ScopeUserWrite,
+	ScopeProductRead,
+	ScopeReportRead,
+	ScopeReportWrite,
+	ScopeMapsetRead,
+}
+
+var ErrInvalidScope = errors.New("invalid scope")
+
+// ParseScope splits a space-delimited scope string into its scopes, dropping
+// duplicates
+func ParseScope(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// ValidateScopes returns ErrInvalidScope if any of the scopes is not supported
+func ValidateScopes(scopes []string) error {
+	for _, s := range scopes {
+		if !slices.Contains(SupportedScopes, s) {
+			return ErrInvalidScope
+		}
+	}
+	return nil
+}
+
+// GrantScope returns the scope granted to an application for the requested
+// scope. Applications without allowed scopes are allowed the DefaultScopes.
+// The requested scopes the application is allowed are granted, or all of its
+// allowed scopes except management if it requests nothing. Management is only
+// granted when it is requested.
+func GrantScope(allowed []string, requested string) (string, error) {
+	scopes := ParseScope(requested)
+	if err := ValidateScopes(scopes); err != nil {
+		return "", err
+	}
+
+	if len(allowed) == 0 {
+		allowed = DefaultScopes
+	}
+	if len(scopes) == 0 {
+		scopes = slices.DeleteFunc(slices.Clone(allowed), func(s string) bool {
+			return s == ScopeManagement
+		})
+	}
+
+	var granted []string
+	for _, s := range scopes {
+		if slices.Contains(allowed, s) {
+			granted = append(granted, s)
+		}
+	}
+	if len(granted) == 0 {
+		return "", ErrInvalidScope
+	}
+	return strings.Join(granted, " "), nil
+}
+
+// HasScope reports whether the granted scopes include the required scope. Only
+// ScopeUnrestricted covers every scope; no scopes grant nothing.
+func HasScope(granted []string, scope string) bool {
+	return slices.Contains(granted, scope) || slices.Contains(granted, ScopeUnrestricted)
+}
+
+// ScopeDescriptions explains each scope to the user on the consent screen
+var ScopeDescriptions = map[string]string{
+	oidc.ScopeOpenID:  "Sign you in with your FunderMaps account",
+	oidc.ScopeProfile: "View your name and profile picture",
+	oidc.ScopeEmail:   "View your email address",
+	ScopeUserRead:     "View your account details",
+	ScopeUserWrite:    "Change your account details",
+	ScopeProductRead:  "View building analyses and statistics",
+	ScopeReportRead:   "View reports",
+	ScopeReportWrite:  "Create and submit reports",
+	ScopeMapsetRead:   "View your maps",
+	ScopeManagement:   "Manage FunderMaps on your behalf",
+}
+
+// CoversScope reports whether a consent for the consented scope also covers
+// the requested scope. An empty consent covers nothing.
+func CoversScope(consented string, requested string) bool {
+	if consented == "" {
+		return false
+	}
+
+	consentedScopes := ParseScope(consented)
+	for _, s := range ParseScope(requested) {
+		if !slices.Contains(consentedScopes, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeScope returns the union of both scopes
+func MergeScope(a string, b string) string {
+	return strings.Join(ParseScope(a+" "+b), " ")
+}
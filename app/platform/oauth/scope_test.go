@@ -0,0 +1,92 @@
+package oauth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGrantScope(t *testing.T) {
+	testCases := []struct {
+		allowed   []string
+		requested string
+		expected  string
+		err       error
+	}{
+		{nil, "", strings.Join(DefaultScopes, " "), nil},
+		{nil, "product:read openid", "product:read openid", nil},
+		{nil, "product:read product:read", "product:read", nil},
+		{nil, "management", "", ErrInvalidScope},
+		{nil, "unknown", "", ErrInvalidScope},
+		{nil, "*", "", ErrInvalidScope},
+		{[]string{"product:read", "report:read"}, "", "product:read report:read", nil},
+		{[]string{"product:read", "management"}, "", "product:read", nil},
+		{[]string{"product:read", "management"}, "management", "management", nil},
+		{[]string{"product:read", "report:read"}, "report:read", "report:read", nil},
+		{[]string{"product:read"}, "product:read management", "product:read", nil},
+		{[]string{"product:read"}, "management", "", ErrInvalidScope},
+	}
+
+	for _, tc := range testCases {
+		granted, err := GrantScope(tc.allowed, tc.requested)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("GrantScope(%v, %q) error = %v, want %v", tc.allowed, tc.requested, err, tc.err)
+		}
+		if granted != tc.expected {
+			t.Errorf("GrantScope(%v, %q) = %q, want %q", tc.allowed, tc.requested, granted, tc.expected)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	if HasScope(nil, ScopeProductRead) {
+		t.Error("HasScope(nil) = true, want false for tokens without scopes")
+	}
+	if !HasScope([]string{ScopeUnrestricted}, ScopeManagement) {
+		t.Error("HasScope() = false, want true for unrestricted tokens")
+	}
+	if !HasScope([]string{ScopeProductRead}, ScopeProductRead) {
+		t.Error("HasScope() = false, want true for granted scope")
+	}
+	if HasScope([]string{ScopeProductRead}, ScopeManagement) {
+		t.Error("HasScope() = true, want false for scope not granted")
+	}
+}
+
+func TestCoversScope(t *testing.T) {
+	testCases := []struct {
+		consented string
+		requested string
+		expected  bool
+	}{
+		{"", "", false},
+		{"", "product:read", false},
+		{"product:read", "", true},
+		{"product:read report:read", "report:read", true},
+		{"product:read", "product:read report:read", false},
+	}
+
+	for _, tc := range testCases {
+		if result := CoversScope(tc.consented, tc.requested); result != tc.expected {
+			t.Errorf("CoversScope(%q, %q) = %v, want %v", tc.consented, tc.requested, result, tc.expected)
+		}
+	}
+}
+
+func TestMergeScope(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected string
+	}{
+		{"product:read", "report:read product:read", "product:read report:read"},
+		{"", "product:read", "product:read"},
+		{"product:read", "", "product:read"},
+		{"", "", ""},
+	}
+
+	for _, tc := range testCases {
+		if result := MergeScope(tc.a, tc.b); result != tc.expected {
+			t.Errorf("MergeScope(%q, %q) = %q, want %q", tc.a, tc.b, result, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package oidc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmES256} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := GenerateKey("test", algorithm)
+			if err != nil {
+				t.Fatalf("GenerateKey() error = %v", err)
+			}
+
+			token, err := key.Sign(Claims{"sub": "user", "exp": time.Now().Add(time.Hour).Unix()})
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+
+			claims, err := Verify(token, []*Key{key})
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims["sub"] != "user" {
+				t.Errorf("Verify() sub = %v, want user", claims["sub"])
+			}
+
+			other, err := GenerateKey("other", algorithm)
+			if err != nil {
+				t.Fatalf("GenerateKey() error = %v", err)
+			}
+			if _, err := Verify(token, []*Key{other}); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("Verify() with unknown key error = %v, want %v", err, ErrUnknownKey)
+			}
+
+			expired, err := key.Sign(Claims{"sub": "user", "exp": time.Now().Add(-time.Minute).Unix()})
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if _, err := Verify(expired, []*Key{key}); !errors.Is(err, ErrTokenExpired) {
+				t.Errorf("Verify() expired error = %v, want %v", err, ErrTokenExpired)
+			}
+
+			tampered := token[:len(token)-4] + "AAAA"
+			if _, err := Verify(tampered, []*Key{key}); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify() tampered error = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
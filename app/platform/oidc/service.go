@@ -0,0 +1,193 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+	"fundermaps/pkg/utils"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+
+	IDTokenExpiration = time.Hour
+
+	// KeySetMaxAge is how long relying parties may cache the key set
+	KeySetMaxAge = 5 * time.Minute
+
+	// A new key is published this long before it signs, so it is in every
+	// cached key set by the time tokens signed with it show up
+	keyActivationDelay = 2 * KeySetMaxAge
+)
+
+// Service manages the key set of the OpenID provider. The next signing key is
+// generated and published ahead of the rotation and only signs once cached key
+// sets have picked it up. Retired keys stay published for another rotation
+// period so tokens signed shortly before a rotation can still be verified.
+type Service struct {
+	db        *gorm.DB
+	algorithm string
+	rotation  time.Duration
+}
+
+// NewService creates a new OpenID provider service
+func NewService(db *gorm.DB, cfg *config.Config) *Service {
+	return &Service{
+		db:        db,
+		algorithm: cfg.OIDCSigningAlgorithm,
+		rotation:  time.Duration(cfg.OIDCKeyRotation) * 24 * time.Hour,
+	}
+}
+
+// SigningKey returns the current signing key. The next key is created once the
+// newest key is due for rotation, and takes over after the activation delay.
+func (s *Service) SigningKey() (*Key, error) {
+	now := time.Now()
+
+	var signingKeys []database.SigningKey
+	result := s.db.Where("algorithm = ? AND created_at > ?", s.algorithm, now.Add(-2*s.rotation)).
+		Order("created_at DESC").
+		Find(&signingKeys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	// Nothing published yet, so nobody can hold a stale key set
+	if len(signingKeys) == 0 {
+		return s.rotate()
+	}
+
+	if signingKeys[0].CreatedAt.Before(now.Add(-(s.rotation - keyActivationDelay))) {
+		if _, err := s.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return parseSigningKey(ActiveSigningKey(signingKeys, now))
+}
+
+// ActiveSigningKey returns the newest key, ordered newest first, that has been
+// published for at least the activation delay, or the oldest key if none has.
+func ActiveSigningKey(signingKeys []database.SigningKey, now time.Time) *database.SigningKey {
+	for i := range signingKeys {
+		if !signingKeys[i].CreatedAt.After(now.Add(-keyActivationDelay)) {
+			return &signingKeys[i]
+		}
+	}
+	return &signingKeys[len(signingKeys)-1]
+}
+
+func (s *Service) rotate() (*Key, error) {
+	key, err := GenerateKey(utils.GenerateRandomString(16), s.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.signer)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKey := database.SigningKey{
+		KeyID:      key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}
+	if err := s.db.Create(&signingKey).Error; err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// PublicKeys returns all keys that may have signed a token that is still valid
+func (s *Service) PublicKeys() ([]*Key, error) {
+	var signingKeys []database.SigningKey
+	result := s.db.Where("created_at > ?", time.Now().Add(-2*s.rotation)).
+		Order("created_at DESC").
+		Find(&signingKeys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	keys := make([]*Key, 0, len(signingKeys))
+	for i := range signingKeys {
+		key, err := parseSigningKey(&signingKeys[i])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// KeySet returns the published key set
+func (s *Service) KeySet() (*JWKSet, error) {
+	keys, err := s.PublicKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	keySet := JWKSet{Keys: make([]JWK, 0, len(keys))}
+	for _, key := range keys {
+		keySet.Keys = append(keySet.Keys, key.JWK())
+	}
+	return &keySet, nil
+}
+
+// Sign signs the claims with the current signing key
+func (s *Service) Sign(claims Claims) (string, error) {
+	key, err := s.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	return key.Sign(claims)
+}
+
+// Verify verifies a token signed by one of the published keys
+func (s *Service) Verify(token string) (Claims, error) {
+	keys, err := s.PublicKeys()
+	if err != nil {
+		return nil, err
+	}
+	return Verify(token, keys)
+}
+
+func parseSigningKey(signingKey *database.SigningKey) (*Key, error) {
+	block, _ := pem.Decode([]byte(signingKey.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not PEM encoded", signingKey.KeyID)
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", signingKey.KeyID, err)
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s cannot sign", signingKey.KeyID)
+	}
+
+	return &Key{ID: signingKey.KeyID, Algorithm: signingKey.Algorithm, signer: signer}, nil
+}
+
+// HasScope reports whether the space delimited scope string contains scope
+func HasScope(scopes string, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package oidc
+
+import (
+	"testing"
+	"time"
+
+	"fundermaps/app/database"
+)
+
+func TestActiveSigningKey(t *testing.T) {
+	now := time.Now()
+	keys := func(ages ...time.Duration) []database.SigningKey {
+		signingKeys := make([]database.SigningKey, len(ages))
+		for i, age := range ages {
+			signingKeys[i] = database.SigningKey{KeyID: age.String(), CreatedAt: now.Add(-age)}
+		}
+		return signingKeys
+	}
+
+	testCases := []struct {
+		name     string
+		keys     []database.SigningKey
+		expected string
+	}{
+		{"only key", keys(time.Minute), "1m0s"},
+		{"next key not yet published long enough", keys(time.Minute, 30*24*time.Hour), "720h0m0s"},
+		{"next key published long enough", keys(time.Hour, 30*24*time.Hour), "1h0m0s"},
+	}
+
+	for _, tc := range testCases {
+		if key := ActiveSigningKey(tc.keys, now); key.KeyID != tc.expected {
+			t.Errorf("ActiveSigningKey(%s) = %s; want %s", tc.name, key.KeyID, tc.expected)
+		}
+	}
+}
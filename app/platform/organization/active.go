@@ -0,0 +1,41 @@
+package organization
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotMember            = errors.New("not a member of the organization")
+	ErrNoActiveOrganization = errors.New("no active organization")
+)
+
+// ActiveOrganization picks the organization a request acts on from the
+// memberships of the user. An explicitly requested organization wins and must
+// be one of the memberships. Otherwise the organization bound to the token is
+// used, as long as the user is still a member, and else the only membership.
+// Users in several organizations who did not choose one get
+// ErrNoActiveOrganization.
+func ActiveOrganization(roles map[uuid.UUID]string, requested uuid.UUID, bound *uuid.UUID) (uuid.UUID, error) {
+	if requested != uuid.Nil {
+		if _, ok := roles[requested]; !ok {
+			return uuid.Nil, ErrNotMember
+		}
+		return requested, nil
+	}
+
+	if bound != nil {
+		if _, ok := roles[*bound]; ok {
+			return *bound, nil
+		}
+	}
+
+	if len(roles) == 1 {
+		for id := range roles {
+			return id, nil
+		}
+	}
+
+	return uuid.Nil, ErrNoActiveOrganization
+}
@@ -0,0 +1,42 @@
+package organization
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestActiveOrganization(t *testing.T) {
+	first, second, other := uuid.New(), uuid.New(), uuid.New()
+	single := map[uuid.UUID]string{first: RoleReader}
+	multiple := map[uuid.UUID]string{first: RoleReader, second: RoleWriter}
+
+	testCases := []struct {
+		name      string
+		roles     map[uuid.UUID]string
+		requested uuid.UUID
+		bound     *uuid.UUID
+		expected  uuid.UUID
+		err       error
+	}{
+		{"only membership", single, uuid.Nil, nil, first, nil},
+		{"requested", multiple, second, nil, second, nil},
+		{"requested over bound", multiple, second, &first, second, nil},
+		{"requested non-member", multiple, other, nil, uuid.Nil, ErrNotMember},
+		{"bound", multiple, uuid.Nil, &second, second, nil},
+		{"stale bound", single, uuid.Nil, &other, first, nil},
+		{"none chosen", multiple, uuid.Nil, nil, uuid.Nil, ErrNoActiveOrganization},
+		{"no memberships", map[uuid.UUID]string{}, uuid.Nil, nil, uuid.Nil, ErrNoActiveOrganization},
+	}
+
+	for _, tc := range testCases {
+		result, err := ActiveOrganization(tc.roles, tc.requested, tc.bound)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: error = %v, want %v", tc.name, err, tc.err)
+		}
+		if result != tc.expected {
+			t.Errorf("%s: organization = %v, want %v", tc.name, result, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package organization
+
+import (
+	"slices"
+
+	"fundermaps/app/database"
+)
+
+// Fence limits the buildings an organization has access to. A building is
+// inside the fence when its municipality, district or neighborhood is listed.
+type Fence struct {
+	Municipalities []string
+	Districts      []string
+	Neighborhoods  []string
+}
+
+// FenceOf returns the fence of the organization
+func FenceOf(org *database.Organization) Fence {
+	return Fence{
+		Municipalities: org.FenceMunicipality,
+		Districts:      org.FenceDistrict,
+		Neighborhoods:  org.FenceNeighborhood,
+	}
+}
+
+// Unrestricted reports whether the fence is empty, which grants access to
+// every building
+func (f Fence) Unrestricted() bool {
+	return len(f.Municipalities) == 0 && len(f.Districts) == 0 && len(f.Neighborhoods) == 0
+}
+
+// Contains reports whether a building in the municipality, district and
+// neighborhood is inside the fence
+func (f Fence) Contains(municipalityID string, districtID string, neighborhoodID string) bool {
+	if f.Unrestricted() {
+		return true
+	}
+
+	return (municipalityID != "" && slices.Contains(f.Municipalities, municipalityID)) ||
+		(districtID != "" && slices.Contains(f.Districts, districtID)) ||
+		(neighborhoodID != "" && slices.Contains(f.Neighborhoods, neighborhoodID))
+}
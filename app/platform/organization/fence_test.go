@@ -0,0 +1,33 @@
+package organization
+
+import "testing"
+
+func TestFenceContains(t *testing.T) {
+	fence := Fence{
+		Municipalities: []string{"GM0606"},
+		Districts:      []string{"WK059901"},
+		Neighborhoods:  []string{"BU05990110"},
+	}
+
+	testCases := []struct {
+		name         string
+		fence        Fence
+		municipality string
+		district     string
+		neighborhood string
+		expected     bool
+	}{
+		{"unrestricted", Fence{}, "GM0363", "WK036301", "BU03630101", true},
+		{"municipality", fence, "GM0606", "WK060601", "BU06060101", true},
+		{"district", fence, "GM0599", "WK059901", "BU05990101", true},
+		{"neighborhood", fence, "GM0599", "WK059902", "BU05990110", true},
+		{"outside", fence, "GM0599", "WK059902", "BU05990201", false},
+		{"unknown location", fence, "", "", "", false},
+	}
+
+	for _, tc := range testCases {
+		if result := tc.fence.Contains(tc.municipality, tc.district, tc.neighborhood); result != tc.expected {
+			t.Errorf("%s: Contains = %v, want %v", tc.name, result, tc.expected)
+		}
+	}
+}
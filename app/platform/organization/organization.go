@@ -0,0 +1,43 @@
+package organization
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/database"
+)
+
+var ErrOrganizationNotFound = errors.New("organization not found")
+
+// Delete soft deletes the organization. Memberships are kept, but no longer
+// grant a role. Sessions that chose the organization as active organization
+// are revoked and pending invitations expire.
+func Delete(db *gorm.DB, organizationID uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&database.Organization{}, "id = ?", organizationID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationNotFound
+		}
+
+		if err := tx.Model(&database.AuthRefreshToken{}).
+			Where("organization_id = ? AND revoked_at IS NULL", organizationID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&database.AuthAccessToken{}).
+			Where("organization_id = ? AND expired_at > now()", organizationID).
+			Update("expired_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&database.Invitation{}).
+			Where("organization_id = ? AND accepted_at IS NULL AND expired_at > now()", organizationID).
+			Update("expired_at", time.Now()).Error
+	})
+}
@@ -0,0 +1,49 @@
+package organization
+
+import (
+	"slices"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Roles of a member within an organization, from least to most privileged.
+// Every role includes the permissions of the roles before it.
+const (
+	RoleReader    = "reader"
+	RoleWriter    = "writer"
+	RoleVerifier  = "verifier"
+	RoleSuperuser = "superuser"
+)
+
+var Roles = []string{RoleReader, RoleWriter, RoleVerifier, RoleSuperuser}
+
+// HasRole reports whether the role grants at least the required role. Unknown
+// roles grant nothing.
+func HasRole(role string, required string) bool {
+	rank := slices.Index(Roles, role)
+	return rank >= 0 && rank >= slices.Index(Roles, required)
+}
+
+// MembershipRoles returns the role of the user in each of their organizations
+// that has not been deleted
+func MembershipRoles(db *gorm.DB, userID uuid.UUID) (map[uuid.UUID]string, error) {
+	var memberships []struct {
+		OrganizationID uuid.UUID
+		Role           string
+	}
+	err := db.Table("application.organization_user").
+		Select("organization_user.organization_id, organization_user.role").
+		Joins("JOIN application.organization o ON o.id = organization_user.organization_id").
+		Where("organization_user.user_id = ? AND o.deleted_at IS NULL", userID).
+		Scan(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[uuid.UUID]string, len(memberships))
+	for _, m := range memberships {
+		roles[m.OrganizationID] = m.Role
+	}
+	return roles, nil
+}
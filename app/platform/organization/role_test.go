@@ -0,0 +1,26 @@
+package organization
+
+import "testing"
+
+func TestHasRole(t *testing.T) {
+	testCases := []struct {
+		role     string
+		required string
+		expected bool
+	}{
+		{RoleReader, RoleReader, true},
+		{RoleReader, RoleWriter, false},
+		{RoleWriter, RoleReader, true},
+		{RoleVerifier, RoleWriter, true},
+		{RoleWriter, RoleVerifier, false},
+		{RoleSuperuser, RoleVerifier, true},
+		{"", RoleReader, false},
+		{"owner", RoleReader, false},
+	}
+
+	for _, tc := range testCases {
+		if result := HasRole(tc.role, tc.required); result != tc.expected {
+			t.Errorf("HasRole(%q, %q) = %v, want %v", tc.role, tc.required, result, tc.expected)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fundermaps/pkg/utils"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"slices"
 
@@ -54,6 +55,10 @@ type StorageService interface {
 
 	// UpdateFileStatus updates the status of files associated with a key
 	UpdateFileStatus(db *gorm.DB, key string, status string) error
+
+	// PruneAbandonedUploads removes files uploaded before the given time
+	// that were never attached to anything
+	PruneAbandonedUploads(db *gorm.DB, before time.Time) (int, error)
 }
 
 // storageService implements StorageService interface
@@ -160,3 +165,28 @@ func (s *storageService) UpdateFileStatus(db *gorm.DB, key string, status string
 
 	return nil
 }
+
+// PruneAbandonedUploads removes files uploaded before the given time that
+// still have the uploaded status, from storage and from the database
+func (s *storageService) PruneAbandonedUploads(db *gorm.DB, before time.Time) (int, error) {
+	var files []database.FileResource
+	result := db.Where("status = ? AND created_at < ?", StatusUploaded, before).Find(&files)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to find abandoned uploads: %w", result.Error)
+	}
+
+	deleted := 0
+	for _, file := range files {
+		filePath := fmt.Sprintf("%s/%s/%s", DefaultUploadPath, file.Key, file.OriginalFilename)
+		if err := s.storage.Delete(filePath); err != nil {
+			return deleted, fmt.Errorf("failed to delete file: %w", err)
+		}
+
+		if err := db.Delete(&file).Error; err != nil {
+			return deleted, fmt.Errorf("failed to delete file metadata: %w", err)
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,379 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/database"
+	"fundermaps/pkg/utils"
+)
+
+const (
+	TokenType = "Bearer"
+
+	AccessTokenExpiration  = time.Hour
+	RefreshTokenExpiration = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// AuthToken is the token pair handed out to clients
+type AuthToken struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresIn    int       `json:"expires_in"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+	IDToken      string    `json:"id_token,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+
+	OrganizationID *uuid.UUID `json:"organization_id,omitempty"`
+}
+
+// Service manages access and refresh tokens. Tokens are only stored as SHA-256
+// hashes; the plaintext is handed to the client once. Every refresh token
+// belongs to a family that starts when a user signs in. Rotating a refresh
+// token revokes it and issues its successor in the same family, so presenting
+// a revoked token again means it was copied and the whole family is revoked.
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new token service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Issue mints a token pair in a new family. The scope and the optional active
+// organization are stored on both tokens and carried over when the refresh
+// token is rotated.
+func (s *Service) Issue(clientID string, userID uuid.UUID, organizationID *uuid.UUID, scope string, ipAddress string, userAgent string) (*AuthToken, error) {
+	var authToken *AuthToken
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		authToken, err = s.issue(tx, clientID, userID, organizationID, scope, ipAddress, userAgent, uuid.New())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return authToken, nil
+}
+
+func (s *Service) issue(tx *gorm.DB, clientID string, userID uuid.UUID, organizationID *uuid.UUID, scope string, ipAddress string, userAgent string, familyID uuid.UUID) (*AuthToken, error) {
+	accessToken := fmt.Sprintf("fmat%s", utils.GenerateRandomString(40))
+	refreshToken := fmt.Sprintf("fmrt%s", utils.GenerateRandomString(40))
+
+	authAccessToken := database.AuthAccessToken{
+		AccessToken:    utils.HashToken(accessToken),
+		IPAddress:      ipAddress,
+		UserAgent:      userAgent,
+		ApplicationID:  clientID,
+		UserID:         userID,
+		FamilyID:       familyID,
+		OrganizationID: organizationID,
+		Scope:          scope,
+		ExpiredAt:      time.Now().Add(AccessTokenExpiration),
+	}
+	authRefreshToken := database.AuthRefreshToken{
+		Token:          utils.HashToken(refreshToken),
+		IPAddress:      ipAddress,
+		UserAgent:      userAgent,
+		ApplicationID:  clientID,
+		UserID:         userID,
+		FamilyID:       familyID,
+		OrganizationID: organizationID,
+		Scope:          scope,
+		ExpiredAt:      time.Now().Add(RefreshTokenExpiration),
+	}
+
+	if err := tx.Create(&authAccessToken).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&authRefreshToken).Error; err != nil {
+		return nil, err
+	}
+
+	return &AuthToken{
+		AccessToken:  accessToken,
+		TokenType:    TokenType,
+		ExpiresIn:    int(AccessTokenExpiration.Seconds()),
+		ExpiresAt:    authAccessToken.ExpiredAt,
+		RefreshToken: refreshToken,
+		Scope:        scope,
+
+		OrganizationID: organizationID,
+	}, nil
+}
+
+// GetRefreshToken looks up an unexpired refresh token issued to the client.
+// If the token was already rotated or revoked, its family is revoked and
+// ErrRefreshTokenReused is returned together with the token, so the caller
+// can record the incident.
+func (s *Service) GetRefreshToken(clientID string, refreshToken string) (*database.AuthRefreshToken, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var token database.AuthRefreshToken
+	result := s.db.First(&token, "token = ? AND application_id = ? AND expired_at > now()", utils.HashToken(refreshToken), clientID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, result.Error
+	}
+
+	if token.RevokedAt != nil {
+		if err := s.RevokeFamily(token.FamilyID); err != nil {
+			return nil, err
+		}
+		return &token, ErrRefreshTokenReused
+	}
+
+	return &token, nil
+}
+
+// Rotate revokes the refresh token and issues a new pair in the same family.
+// When two requests race to rotate the same token only one wins; the other is
+// treated as reuse.
+func (s *Service) Rotate(refreshToken *database.AuthRefreshToken, ipAddress string, userAgent string) (*AuthToken, error) {
+	var authToken *AuthToken
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.AuthRefreshToken{}).
+			Where("token = ? AND revoked_at IS NULL", refreshToken.Token).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		authToken, err = s.issue(tx, refreshToken.ApplicationID, refreshToken.UserID, refreshToken.OrganizationID, refreshToken.Scope, ipAddress, userAgent, refreshToken.FamilyID)
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if err := s.RevokeFamily(refreshToken.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return authToken, nil
+}
+
+// RevokeFamily revokes every refresh token in the family and expires all
+// access tokens issued from it
+func (s *Service) RevokeFamily(familyID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.AuthRefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&database.AuthAccessToken{}).
+			Where("family_id = ? AND expired_at > now()", familyID).
+			Update("expired_at", time.Now()).Error
+	})
+}
+
+// RevokeApplication revokes all tokens the application holds for the user
+func (s *Service) RevokeApplication(userID uuid.UUID, applicationID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.AuthRefreshToken{}).
+			Where("user_id = ? AND application_id = ? AND revoked_at IS NULL", userID, applicationID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&database.AuthAccessToken{}).
+			Where("user_id = ? AND application_id = ? AND expired_at > now()", userID, applicationID).
+			Update("expired_at", time.Now()).Error
+	})
+}
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a sign in on a device. It spans all tokens rotated from the same
+// sign in, so its ID is the refresh token family.
+type Session struct {
+	ID              uuid.UUID `json:"id"`
+	ApplicationID   string    `json:"application_id"`
+	ApplicationName string    `json:"application_name"`
+	IPAddress       string    `json:"ip_address"`
+	UserAgent       string    `json:"user_agent"`
+	CreatedAt       time.Time `json:"created_at"`
+	LastActiveAt    time.Time `json:"last_active_at"`
+	ExpiredAt       time.Time `json:"expired_at"`
+	Current         bool      `json:"current"`
+}
+
+// Sessions returns the active sessions of the user, most recently used first.
+// A session is active as long as its refresh token can be used.
+func (s *Service) Sessions(userID uuid.UUID) ([]Session, error) {
+	var sessions []Session
+	err := s.db.Raw(`
+		SELECT
+			rt.family_id AS id,
+			rt.application_id,
+			a.name AS application_name,
+			rt.ip_address,
+			rt.user_agent,
+			(SELECT min(f.created_at) FROM application.auth_refresh_token f WHERE f.family_id = rt.family_id) AS created_at,
+			rt.created_at AS last_active_at,
+			rt.expired_at
+		FROM application.auth_refresh_token rt
+		JOIN application.application a ON a.application_id = rt.application_id
+		WHERE rt.user_id = ? AND rt.revoked_at IS NULL AND rt.expired_at > now()
+		ORDER BY rt.created_at DESC`, userID).
+		Scan(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes a single session of the user
+func (s *Service) RevokeSession(userID uuid.UUID, sessionID uuid.UUID) error {
+	var count int64
+	err := s.db.Model(&database.AuthRefreshToken{}).
+		Where("family_id = ? AND user_id = ? AND revoked_at IS NULL AND expired_at > now()", sessionID, userID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrSessionNotFound
+	}
+
+	return s.RevokeFamily(sessionID)
+}
+
+// RevokeAll revokes every session of the user
+func (s *Service) RevokeAll(userID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.AuthRefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&database.AuthAccessToken{}).
+			Where("user_id = ? AND expired_at > now()", userID).
+			Update("expired_at", time.Now()).Error
+	})
+}
+
+// Token type hints accepted by Find, as defined in RFC 7009
+const (
+	HintAccessToken  = "access_token"
+	HintRefreshToken = "refresh_token"
+)
+
+var ErrTokenNotFound = errors.New("token not found")
+
+// Info describes an access or refresh token found by Find
+type Info struct {
+	Type          string
+	ApplicationID string
+	UserID        uuid.UUID
+	FamilyID      uuid.UUID
+	Scope         string
+	CreatedAt     time.Time
+	ExpiredAt     time.Time
+	RevokedAt     *time.Time
+
+	hash string
+}
+
+// Active reports whether the token can still be used
+func (i *Info) Active() bool {
+	return i.RevokedAt == nil && i.ExpiredAt.After(time.Now())
+}
+
+// Find looks up an access or refresh token by its value. The hinted type is
+// tried first, but a wrong hint does not prevent the token from being found.
+func (s *Service) Find(value string, hint string) (*Info, error) {
+	if value == "" {
+		return nil, ErrTokenNotFound
+	}
+
+	lookups := []func(string) (*Info, error){s.findAccessToken, s.findRefreshToken}
+	if hint == HintRefreshToken {
+		lookups = []func(string) (*Info, error){s.findRefreshToken, s.findAccessToken}
+	}
+
+	for _, lookup := range lookups {
+		info, err := lookup(value)
+		if err == nil {
+			return info, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	return nil, ErrTokenNotFound
+}
+
+func (s *Service) findAccessToken(value string) (*Info, error) {
+	var token database.AuthAccessToken
+	if err := s.db.First(&token, "access_token = ?", utils.HashToken(value)).Error; err != nil {
+		return nil, err
+	}
+
+	return &Info{
+		hash:          token.AccessToken,
+		Type:          HintAccessToken,
+		ApplicationID: token.ApplicationID,
+		UserID:        token.UserID,
+		FamilyID:      token.FamilyID,
+		Scope:         token.Scope,
+		CreatedAt:     token.CreatedAt,
+		ExpiredAt:     token.ExpiredAt,
+	}, nil
+}
+
+func (s *Service) findRefreshToken(value string) (*Info, error) {
+	var token database.AuthRefreshToken
+	if err := s.db.First(&token, "token = ?", utils.HashToken(value)).Error; err != nil {
+		return nil, err
+	}
+
+	return &Info{
+		hash:          token.Token,
+		Type:          HintRefreshToken,
+		ApplicationID: token.ApplicationID,
+		UserID:        token.UserID,
+		FamilyID:      token.FamilyID,
+		Scope:         token.Scope,
+		CreatedAt:     token.CreatedAt,
+		ExpiredAt:     token.ExpiredAt,
+		RevokedAt:     token.RevokedAt,
+	}, nil
+}
+
+// Revoke invalidates a token found by Find. Revoking a refresh token revokes
+// its entire family, including the access tokens issued from it.
+func (s *Service) Revoke(info *Info) error {
+	if info.Type == HintRefreshToken {
+		return s.RevokeFamily(info.FamilyID)
+	}
+
+	return s.db.Model(&database.AuthAccessToken{}).
+		Where("access_token = ? AND expired_at > now()", info.hash).
+		Update("expired_at", time.Now()).Error
+}
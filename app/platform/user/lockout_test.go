@@ -0,0 +1,32 @@
+package user
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	policy := LockoutPolicy{
+		Threshold:   5,
+		Duration:    15 * time.Minute,
+		MaxDuration: 2 * time.Hour,
+	}
+
+	testCases := []struct {
+		lockoutCount int
+		expected     time.Duration
+	}{
+		{0, 15 * time.Minute},
+		{1, 30 * time.Minute},
+		{2, time.Hour},
+		{3, 2 * time.Hour},
+		{4, 2 * time.Hour},
+		{100, 2 * time.Hour},
+	}
+
+	for _, tc := range testCases {
+		if duration := policy.LockoutDuration(tc.lockoutCount); duration != tc.expected {
+			t.Errorf("LockoutDuration(%d) = %v, want %v", tc.lockoutCount, duration, tc.expected)
+		}
+	}
+}
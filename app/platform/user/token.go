@@ -0,0 +1,77 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"fundermaps/app/database"
+	"fundermaps/pkg/utils"
+)
+
+// Purposes of a user token. A token is only accepted for its own purpose.
+const (
+	TokenPurposeUnlock        = "unlock"
+	TokenPurposePasswordReset = "password_reset"
+	TokenPurposeVerifyEmail   = "verify_email"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// CreateToken issues a single use token for the user. Only its hash is stored.
+func (s *UserService) CreateToken(userID uuid.UUID, purpose string, expiration time.Duration) (string, error) {
+	token := fmt.Sprintf("fmut%s", utils.GenerateRandomString(40))
+
+	userToken := database.UserToken{
+		Token:     utils.HashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiredAt: time.Now().Add(expiration),
+	}
+	if err := s.db.Create(&userToken).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeToken marks the token as used and returns the user it was issued to.
+// Only one of several concurrent requests with the same token succeeds.
+func (s *UserService) ConsumeToken(token string, purpose string) (*database.User, error) {
+	var userToken database.UserToken
+	result := s.db.First(&userToken, "token = ? AND purpose = ? AND used_at IS NULL AND expired_at > now()", utils.HashToken(token), purpose)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, result.Error
+	}
+
+	result = s.db.Model(&database.UserToken{}).
+		Where("token = ? AND used_at IS NULL", userToken.Token).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	var user database.User
+	if err := s.db.First(&user, "id = ?", userToken.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RevokeTokens invalidates all unused tokens of the user for the purpose
+func (s *UserService) RevokeTokens(userID uuid.UUID, purpose string) error {
+	return s.db.Model(&database.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("expired_at", time.Now()).Error
+}
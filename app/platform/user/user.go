@@ -3,12 +3,17 @@ package user
 import (
 	"errors"
 	"fundermaps/app/database"
-	"fundermaps/pkg/utils"
+	"fundermaps/app/platform/token"
+	"fundermaps/pkg/password"
+	"log"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
 type UserService struct {
 	db *gorm.DB
 }
@@ -31,7 +36,7 @@ func (s *UserService) GetUserByID(userID uuid.UUID) (*database.User, error) {
 	result := s.db.First(&user, "id = ?", userID)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, result.Error
 	}
@@ -44,13 +49,26 @@ func (s *UserService) GetUserByEmail(email string) (*database.User, error) {
 	result := s.db.First(&user, "email = ?", email)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, result.Error
 	}
 	return &user, nil
 }
 
+// EmailDeleted reports whether the email belongs to a deleted user. Emails of
+// deleted users stay taken, so they cannot be signed up or invited again.
+func (s *UserService) EmailDeleted(email string) (bool, error) {
+	var count int64
+	result := s.db.Unscoped().Model(&database.User{}).
+		Where("email = ? AND deleted_at IS NOT NULL", email).
+		Count(&count)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return count > 0, nil
+}
+
 func (s *UserService) Update(user *database.User) error {
 	result := s.db.Save(user)
 	if result.Error != nil {
@@ -59,8 +77,12 @@ func (s *UserService) Update(user *database.User) error {
 	return nil
 }
 
-func (s *UserService) UpdatePassword(user *database.User, password string) error {
-	user.PasswordHash = utils.HashLegacyPassword(password)
+func (s *UserService) UpdatePassword(user *database.User, newPassword string) error {
+	hash, err := password.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
 
 	result := s.db.Save(user)
 	if result.Error != nil {
@@ -69,16 +91,49 @@ func (s *UserService) UpdatePassword(user *database.User, password string) error
 	return nil
 }
 
-func (s *UserService) IsLocked(user *database.User) bool {
-	return user.AccessFailedCount >= 5
-}
+// VerifyPassword checks the password of the user. After a successful check a
+// hash in a legacy format or with outdated parameters is replaced.
+func (s *UserService) VerifyPassword(user *database.User, plaintext string) bool {
+	if user.PasswordHash == "" || !password.Verify(plaintext, user.PasswordHash) {
+		return false
+	}
 
-func (s *UserService) IncrementAccessFailedCount(user *database.User) error {
-	user.AccessFailedCount++
+	if password.NeedsRehash(user.PasswordHash) {
+		hash, err := password.Hash(plaintext)
+		if err != nil {
+			log.Printf("Failed to rehash password of user %s: %v", user.ID, err)
+			return true
+		}
 
-	result := s.db.Save(user)
-	if result.Error != nil {
-		return result.Error
+		if err := s.db.Model(user).Update("password_hash", hash).Error; err != nil {
+			log.Printf("Failed to rehash password of user %s: %v", user.ID, err)
+		}
 	}
-	return nil
+
+	return true
+}
+
+// Delete soft deletes the user and revokes everything that lets them in: their
+// sessions, API keys and unused single-use tokens
+func (s *UserService) Delete(userID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&database.User{}, "id = ?", userID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+
+		if err := token.NewService(tx).RevokeAll(userID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&database.AuthKey{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&database.UserToken{}).
+			Where("user_id = ? AND used_at IS NULL AND expired_at > now()", userID).
+			Update("expired_at", time.Now()).Error
+	})
 }
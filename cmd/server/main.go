@@ -22,6 +22,9 @@ import (
 	"fundermaps/app/handlers"
 	mngmt "fundermaps/app/handlers/management"
 	"fundermaps/app/middleware"
+	"fundermaps/app/platform/oauth"
+	"fundermaps/app/platform/oidc"
+	"fundermaps/app/platform/organization"
 )
 
 func main() {
@@ -80,37 +83,74 @@ func main() {
 	app.Get("/auth/login", func(c *fiber.Ctx) error {
 		return c.SendFile("./public/login.html")
 	})
-	app.Post("/auth/login", limiter.New(limiter.Config{Max: 50}), handlers.LoginWithForm)
+	app.Post("/auth/login", limiter.New(limiter.Config{Max: 50}), middleware.ThrottleFailedLogins, handlers.LoginWithForm)
+	app.Get("/auth/login/mfa", func(c *fiber.Ctx) error {
+		return c.SendFile("./public/mfa.html")
+	})
+	app.Post("/auth/login/mfa", limiter.New(limiter.Config{Max: 50}), middleware.ThrottleFailedLogins, handlers.LoginWithMFA)
 	app.Get("/auth/logout", handlers.Logout)
+	app.Get("/auth/consent", handlers.GetConsent)
+	app.Post("/auth/consent", handlers.PostConsent)
+
+	// OpenID Connect discovery
+	app.Get("/.well-known/openid-configuration", handlers.GetOpenIDConfiguration)
+	app.Get("/.well-known/jwks.json", handlers.GetJWKS)
 
 	// General API
 	api := app.Group("/api")
 	api.Get("/app/:application_id?", handlers.GetApplication)
-	api.Get("/data/contractor", middleware.AuthMiddleware, handlers.GetAllContractors) // TODO: Why not add the contractors to the application data?
+	api.Get("/data/contractor", middleware.AuthMiddleware, middleware.RequireScope(oauth.ScopeReportRead), handlers.GetAllContractors) // TODO: Why not add the contractors to the application data?
 
 	// Auth API
 	auth := api.Group("/auth", limiter.New(limiter.Config{Max: 50}))
-	auth.Post("/signin", handlers.SigninWithPassword)
+	auth.Post("/signin", middleware.ThrottleFailedLogins, handlers.SigninWithPassword)
+	auth.Post("/signin/mfa", middleware.ThrottleFailedLogins, handlers.SigninWithMFA)
 	auth.Post("/token-refresh", middleware.AuthMiddleware, handlers.RefreshToken)
-	auth.Post("/change-password", middleware.AuthMiddleware, handlers.ChangePassword)
+	auth.Post("/change-password", middleware.AuthMiddleware, middleware.RequireScope(oauth.ScopeUnrestricted), handlers.ChangePassword)
 	auth.Post("/forgot-password", handlers.ForgotPassword)
 	auth.Post("/reset-password", handlers.ResetPassword)
+	auth.Post("/unlock", handlers.UnlockAccount)
+	auth.Post("/verify-email", handlers.VerifyEmail)
+
+	invitation := api.Group("/invitation", limiter.New(limiter.Config{Max: 50}))
+	invitation.Get("/", handlers.GetInvitation)
+	invitation.Post("/accept", handlers.AcceptInvitation)
 
 	// OAuth2 API
 	oauth2 := api.Group("/v1/oauth2", limiter.New(limiter.Config{Max: 50}))
 	oauth2.Get("/authorize", handlers.AuthorizationRequest)
 	oauth2.Post("/token", handlers.TokenRequest)
-	oauth2.Get("/userinfo", middleware.AuthMiddleware, handlers.GetUserInfo)
+	oauth2.Post("/revoke", handlers.RevokeToken)
+	oauth2.Post("/introspect", handlers.IntrospectToken)
+	oauth2.Get("/userinfo", middleware.AuthMiddleware, middleware.RequireScope(oidc.ScopeOpenID), handlers.GetUserInfo)
 
 	// User API
 	user := api.Group("/user", middleware.AuthMiddleware)
-	user.Get("/me", handlers.GetCurrentUser)
-	user.Put("/me", handlers.UpdateCurrentUser)
-	user.Get("/metadata", handlers.GetCurrentUserMetadata)
-	user.Put("/metadata", handlers.UpdateCurrentUserMetadata)
+	user.Get("/me", middleware.RequireScope(oauth.ScopeUserRead), handlers.GetCurrentUser)
+	user.Put("/me", middleware.RequireScope(oauth.ScopeUserWrite), handlers.UpdateCurrentUser)
+	user.Get("/metadata", middleware.RequireScope(oauth.ScopeUserRead), handlers.GetCurrentUserMetadata)
+	user.Put("/metadata", middleware.RequireScope(oauth.ScopeUserWrite), handlers.UpdateCurrentUserMetadata)
+	user.Get("/consents", middleware.RequireScope(oauth.ScopeUserRead), handlers.GetUserConsents)
+	user.Delete("/consents/:application_id", middleware.RequireScope(oauth.ScopeUserWrite), handlers.RevokeUserConsent)
+	user.Get("/api-keys", middleware.RequireScope(oauth.ScopeUserRead), handlers.GetUserAPIKeys)
+	user.Post("/api-keys", middleware.RequireScope(oauth.ScopeUnrestricted), handlers.CreateUserAPIKey)
+	user.Delete("/api-keys/:key_id", middleware.RequireScope(oauth.ScopeUserWrite), handlers.RevokeUserAPIKey)
+	user.Get("/sessions", middleware.RequireScope(oauth.ScopeUserRead), handlers.GetUserSessions)
+	user.Delete("/sessions", middleware.RequireScope(oauth.ScopeUserWrite), handlers.RevokeAllUserSessions)
+	user.Delete("/sessions/:session_id", middleware.RequireScope(oauth.ScopeUserWrite), handlers.RevokeUserSession)
+	user.Post("/verify-email", middleware.RequireScope(oauth.ScopeUserWrite), handlers.SendEmailVerification)
+	user.Post("/mfa/enroll", middleware.RequireScope(oauth.ScopeUnrestricted), handlers.EnrollMFA)
+	user.Post("/mfa/verify", middleware.RequireScope(oauth.ScopeUnrestricted), handlers.VerifyMFA)
+	user.Post("/mfa/disable", middleware.RequireScope(oauth.ScopeUnrestricted), handlers.DisableMFA)
+
+	// Organization API
+	org := api.Group("/organization/:org_id", middleware.AuthMiddleware)
+	org.Get("/user", middleware.RequireScope(oauth.ScopeUserRead), middleware.RequireOrganizationRole(organization.RoleReader), handlers.GetOrganizationUsers)
+	org.Delete("/user/:user_id", middleware.RequireScope(oauth.ScopeUserWrite), middleware.RequireOrganizationRole(organization.RoleSuperuser), handlers.RemoveOrganizationUser)
+	org.Post("/invite", middleware.RequireScope(oauth.ScopeUserWrite), middleware.RequireOrganizationRole(organization.RoleSuperuser), handlers.InviteOrganizationUser)
 
 	// Mapset API
-	mapset := api.Group("/mapset", middleware.AuthMiddleware)
+	mapset := api.Group("/mapset", middleware.AuthMiddleware, middleware.RequireScope(oauth.ScopeMapsetRead))
 	mapset.Get("/:mapset_id?", handlers.GetMapset)
 
 	// Incident API
@@ -124,33 +164,35 @@ func main() {
 	geocoder.Get("/address", handlers.GetAllAddresses)
 
 	// Product API
-	product := api.Group("/product/:building_id", middleware.AuthMiddleware) // TODO: requestid.New() use when serving the public API
+	product := api.Group("/product/:building_id", middleware.AuthMiddleware, middleware.RequireScope(oauth.ScopeProductRead), middleware.GeofenceMiddleware) // TODO: requestid.New() use when serving the public API
 	product.Get("/analysis", middleware.TrackerMiddleware, handlers.GetAnalysis)
 	product.Get("/statistics", handlers.GetStatistics)
 	product.Get("/subsidence", handlers.GetDataSubsidence) // TODO: There may be no need for this endpoint
 	product.Get("/subsidence/historic", handlers.GetDataSubsidenceHistoric)
 
 	// Report API
-	report := api.Group("/report/:building_id", middleware.AuthMiddleware)
+	report := api.Group("/report/:building_id", middleware.AuthMiddleware, middleware.RequireScope(oauth.ScopeReportRead), middleware.GeofenceMiddleware)
 	report.Get("/", handlers.GetReport)
 
 	// Inquiry API
-	inquiry := api.Group("/inquiry", middleware.AuthMiddleware)
-	inquiry.Post("/", handlers.CreateInquiry)
-	inquiry.Post("/:inquiry_id", handlers.CreateInquirySample)
+	inquiry := api.Group("/inquiry", middleware.AuthMiddleware, middleware.RequireScope(oauth.ScopeReportWrite))
+	inquiry.Post("/", middleware.RequireOrganizationRole(organization.RoleWriter), handlers.CreateInquiry)
+	inquiry.Post("/:inquiry_id", middleware.RequireOrganizationRole(organization.RoleWriter), handlers.CreateInquirySample)
+	inquiry.Put("/:inquiry_id/status", middleware.RequireOrganizationRole(organization.RoleVerifier), handlers.UpdateInquiryStatus)
 
 	// Recovery API
-	recovery := api.Group("/recovery", middleware.AuthMiddleware)
-	recovery.Post("/", handlers.CreateRecovery)
-	recovery.Post("/:recovery_id", handlers.CreateRecoverySample)
+	recovery := api.Group("/recovery", middleware.AuthMiddleware, middleware.RequireScope(oauth.ScopeReportWrite))
+	recovery.Post("/", middleware.RequireOrganizationRole(organization.RoleWriter), handlers.CreateRecovery)
+	recovery.Post("/:recovery_id", middleware.RequireOrganizationRole(organization.RoleWriter), handlers.CreateRecoverySample)
+	recovery.Put("/:recovery_id/status", middleware.RequireOrganizationRole(organization.RoleVerifier), handlers.UpdateRecoveryStatus)
 
 	// PDF API
-	pdf := api.Group("/pdf", middleware.AuthMiddleware)
+	pdf := api.Group("/pdf", middleware.AuthMiddleware, middleware.RequireScope(oauth.ScopeReportRead))
 	pdf.Get("/:id", handlers.GetPDF)
 
 	// TODO: Drop the 'v1' from the URL
 	// Management API
-	management := api.Group("/v1/management", middleware.AuthMiddleware, middleware.AdminMiddleware)
+	management := api.Group("/v1/management", middleware.AuthMiddleware, middleware.RequireScope(oauth.ScopeManagement), middleware.AdminMiddleware)
 	management.Get("/app", mngmt.GetAllApplications)
 	management.Post("/app", mngmt.CreateApplication)
 	management_app := management.Group("/app/:app_id")
@@ -163,25 +205,48 @@ func main() {
 	management_incident.Delete("/", mngmt.DeleteIncident)
 	management.Get("/user", mngmt.GetAllUsers)
 	management.Post("/user", mngmt.CreateUser)
-	// management.Get("/user/:email", handlers.GetUserByEmail)
 	management_user := management.Group("/user/:user_id")
 	management_user.Get("/", mngmt.GetUser)
 	management_user.Put("/", mngmt.UpdateUser)
+	management_user.Delete("/", mngmt.DeleteUser)
+	management_user.Get("/organizations", mngmt.GetUserOrganizations)
 	management_user.Get("/api-key", mngmt.CreateApiKey)
 	management_user.Post("/reset-password", mngmt.ResetUserPassword)
+	management_user.Delete("/mfa", mngmt.ResetUserMFA)
+	management_user.Post("/unlock", mngmt.UnlockUser)
+	management_user.Get("/sessions", mngmt.GetUserSessions)
+	management_user.Delete("/sessions", mngmt.RevokeAllUserSessions)
+	management_user.Delete("/sessions/:session_id", mngmt.RevokeUserSession)
+
+	management.Get("/auth-logs", mngmt.GetAuthLogs)
 
 	// Job management routes
 	management.Get("/jobs", mngmt.GetAllJobs)
 	management.Post("/jobs", mngmt.CreateJob)
+	management.Delete("/jobs", mngmt.PurgeJobs)
+	management.Post("/jobs/retry", mngmt.RetryJobs)
 	management_job := management.Group("/jobs/:id")
 	management_job.Get("/", mngmt.GetJob)
+	management_job.Get("/attempts", mngmt.GetJobAttempts)
+	management_job.Get("/events", mngmt.StreamJobEvents)
 	management_job.Post("/cancel", mngmt.CancelJob)
+	management_job.Post("/retry", mngmt.RetryJob)
+	management.Get("/schedules", mngmt.GetAllSchedules)
+	management_schedule := management.Group("/schedules/:name")
+	management_schedule.Post("/pause", mngmt.PauseSchedule)
+	management_schedule.Post("/resume", mngmt.ResumeSchedule)
+	management_schedule.Post("/trigger", mngmt.TriggerSchedule)
+	management.Get("/queues", mngmt.GetAllQueues)
+	management_queue := management.Group("/queues/:job_type")
+	management_queue.Patch("/", mngmt.UpdateQueue)
+	management_queue.Post("/pause", mngmt.PauseQueue)
+	management_queue.Post("/resume", mngmt.ResumeQueue)
 	management.Post("/org", mngmt.CreateOrganization)
 	management.Get("/org", mngmt.GetAllOrganizations)
-	// management.Get("/org/:name", mngmt.GetOrganizationByName) # TODO: Implement
 	management_org := management.Group("/org/:org_id")
 	management_org.Get("/", mngmt.GetOrganization)
 	management_org.Put("/", mngmt.UpdateOrganization)
+	management_org.Delete("/", mngmt.DeleteOrganization)
 	management_org_mapset := management_org.Group("/mapset")
 	// management_org_mapset.Get("/", mngmt.GetAllOrganizationMapsets)
 	management_org_mapset.Post("/", mngmt.AddMapsetToOrganization)
@@ -190,6 +255,8 @@ func main() {
 	management_org_user.Get("/", mngmt.GetAllOrganizationUsers)
 	management_org_user.Post("/", mngmt.AddUserToOrganization)
 	management_org_user.Delete("/", mngmt.RemoveUserFromOrganization)
+	management_org_user.Patch("/:user_id", mngmt.UpdateOrganizationUserRole)
+	management_org.Post("/invite", mngmt.InviteUserToOrganization)
 
 	// Diagnostic API
 	diag := api.Group("/diag")
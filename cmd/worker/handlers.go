@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+	"fundermaps/app/mail"
+	"fundermaps/app/platform/audit"
+	"fundermaps/app/platform/job"
+	"fundermaps/app/platform/storage"
+)
+
+const (
+	JobTypeSendEmail            = job.JobTypeSendEmail
+	JobTypePruneAuthLogs        = "prune_auth_logs"
+	JobTypeCleanupExpiredTokens = "cleanup_expired_tokens"
+	JobTypeRefreshStatistics    = "refresh_statistics"
+	JobTypePruneUploads         = "prune_uploads"
+)
+
+// Uploads that were never attached to a report within this period are removed
+const abandonedUploadAge = 24 * time.Hour
+
+// schedules are created on start unless they exist. Once created they are
+// managed through the management API.
+var schedules = []job.ScheduleInput{
+	{Name: JobTypePruneAuthLogs, JobType: JobTypePruneAuthLogs, Cron: "0 3 * * *", Timezone: "Europe/Amsterdam"},
+	{Name: JobTypeCleanupExpiredTokens, JobType: JobTypeCleanupExpiredTokens, Cron: "15 * * * *", Timezone: "Europe/Amsterdam"},
+	{Name: JobTypeRefreshStatistics, JobType: JobTypeRefreshStatistics, Cron: "0 4 * * *", Timezone: "Europe/Amsterdam"},
+	{Name: JobTypePruneUploads, JobType: JobTypePruneUploads, Cron: "30 3 * * *", Timezone: "Europe/Amsterdam"},
+}
+
+// statisticsViews are the materialized views behind the statistics product
+var statisticsViews = []string{
+	"data.statistics_product_buildings_restored",
+	"data.statistics_product_construction_years",
+	"data.statistics_product_data_collected",
+	"data.statistics_product_foundation_risk",
+	"data.statistics_product_foundation_type",
+	"data.statistics_product_incident_municipality",
+	"data.statistics_product_incidents",
+	"data.statistics_product_inquiries",
+	"data.statistics_product_inquiry_municipality",
+}
+
+// sendEmail sends a templated email. The payload carries the recipients in
+// "to", the "subject", the Mailgun "template" and optional "template_vars".
+func sendEmail(cfg *config.Config) job.Handler {
+	mailer := mail.NewMailer(cfg.MailgunDomain, cfg.MailgunAPIKey, cfg.MailgunAPIBase)
+
+	return func(ctx context.Context, j *database.WorkerJob) error {
+		var to []string
+		switch v := j.Payload["to"].(type) {
+		case string:
+			to = []string{v}
+		case []any:
+			for _, recipient := range v {
+				if s, ok := recipient.(string); ok {
+					to = append(to, s)
+				}
+			}
+		}
+		if len(to) == 0 {
+			return errors.New("payload is missing recipients")
+		}
+
+		subject, _ := j.Payload["subject"].(string)
+		template, _ := j.Payload["template"].(string)
+		if template == "" {
+			return errors.New("payload is missing template")
+		}
+
+		templateVars, _ := j.Payload["template_vars"].(map[string]any)
+
+		message := mail.Email{
+			Subject:      subject,
+			From:         fmt.Sprintf("Fundermaps <no-reply@%s>", cfg.MailgunDomain),
+			To:           to,
+			Template:     template,
+			TemplateVars: templateVars,
+		}
+
+		return mailer.SendTemplatedMail(&message)
+	}
+}
+
+// pruneAuthLogs deletes authentication log events older than the configured
+// retention period
+func pruneAuthLogs(db *gorm.DB, cfg *config.Config) job.Handler {
+	return func(ctx context.Context, j *database.WorkerJob) error {
+		before := time.Now().AddDate(0, 0, -cfg.AuditRetentionDays)
+
+		deleted, err := audit.NewService(db.WithContext(ctx)).Prune(before)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Pruned %d authentication log events before %s", deleted, before.Format(time.RFC3339))
+		return nil
+	}
+}
+
+// cleanupExpiredTokens deletes authorization codes, tokens and reset keys that
+// can no longer be used
+func cleanupExpiredTokens(db *gorm.DB) job.Handler {
+	return func(ctx context.Context, j *database.WorkerJob) error {
+		db := db.WithContext(ctx)
+
+		cleanups := []struct {
+			name  string
+			model any
+			where string
+		}{
+			{"authorization codes", &database.AuthCode{}, "expired_at < now()"},
+			{"access tokens", &database.AuthAccessToken{}, "expired_at < now()"},
+			{"refresh tokens", &database.AuthRefreshToken{}, "expired_at < now()"},
+			{"user tokens", &database.UserToken{}, "expired_at < now()"},
+			{"reset keys", &database.ResetKey{}, "create_date < now() - interval '1 day'"},
+		}
+
+		for _, cleanup := range cleanups {
+			result := db.Where(cleanup.where).Delete(cleanup.model)
+			if result.Error != nil {
+				return fmt.Errorf("failed to delete expired %s: %w", cleanup.name, result.Error)
+			}
+			if result.RowsAffected > 0 {
+				log.Printf("Deleted %d expired %s", result.RowsAffected, cleanup.name)
+			}
+		}
+		return nil
+	}
+}
+
+// refreshStatistics refreshes the materialized views of the statistics product
+func refreshStatistics(db *gorm.DB) job.Handler {
+	return func(ctx context.Context, j *database.WorkerJob) error {
+		for i, view := range statisticsViews {
+			if err := db.WithContext(ctx).Exec("REFRESH MATERIALIZED VIEW " + view).Error; err != nil {
+				return fmt.Errorf("failed to refresh %s: %w", view, err)
+			}
+
+			if err := job.ReportProgress(ctx, (i+1)*100/len(statisticsViews), "Refreshed "+view); err != nil {
+				log.Printf("Failed to report progress of job %d: %v", j.ID, err)
+			}
+		}
+		return nil
+	}
+}
+
+// pruneUploads removes uploaded files that were never attached to a report
+func pruneUploads(db *gorm.DB, cfg *config.Config) job.Handler {
+	return func(ctx context.Context, j *database.WorkerJob) error {
+		storageService := storage.NewStorageService(cfg.Storage())
+
+		deleted, err := storageService.PruneAbandonedUploads(db.WithContext(ctx), time.Now().Add(-abandonedUploadAge))
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Pruned %d abandoned uploads", deleted)
+		return job.SetResult(ctx, map[string]any{"deleted": deleted})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	_ "time/tzdata" // Schedules are evaluated in their own time zone
+
+	"fundermaps/app/config"
+	"fundermaps/app/database"
+	"fundermaps/app/platform/job"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	registry := job.NewRegistry()
+	registry.Register(JobTypeSendEmail, sendEmail(cfg))
+	registry.Register(JobTypePruneAuthLogs, pruneAuthLogs(db, cfg))
+	registry.Register(JobTypeCleanupExpiredTokens, cleanupExpiredTokens(db))
+	registry.Register(JobTypeRefreshStatistics, refreshStatistics(db))
+	registry.Register(JobTypePruneUploads, pruneUploads(db, cfg))
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "worker"
+	}
+
+	jobService := job.NewService(db, cfg)
+
+	for _, schedule := range schedules {
+		if err := jobService.EnsureSchedule(schedule); err != nil {
+			log.Fatalf("Failed to create schedule %s: %v", schedule.Name, err)
+		}
+	}
+
+	worker := job.NewWorker(jobService, registry, job.WorkerOptions{
+		ID:           fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		Concurrency:  cfg.WorkerConcurrency,
+		PollInterval: time.Duration(cfg.WorkerPollInterval) * time.Second,
+		JobTimeout:   time.Duration(cfg.WorkerJobTimeout) * time.Minute,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go jobService.RunScheduler(ctx, time.Duration(cfg.WorkerPollInterval)*time.Second)
+
+	if err := worker.Run(ctx); err != nil {
+		log.Fatalf("Worker stopped with error: %v", err)
+	}
+
+	log.Println("Worker stopped")
+}
@@ -12,7 +12,6 @@ require (
 	github.com/mailgun/mailgun-go/v4 v4.23.0
 	github.com/spf13/viper v1.20.1
 	golang.org/x/crypto v0.39.0
-	golang.org/x/exp v0.0.0-20250606033433-dcc06ee1d476
 	gorm.io/driver/postgres v1.6.0
 	gorm.io/gorm v1.30.0
 )
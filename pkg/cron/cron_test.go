@@ -0,0 +1,107 @@
+package cron
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseInvalid(t *testing.T) {
+	testCases := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every 5m",
+	}
+
+	for _, spec := range testCases {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded; want error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	utc := func(s string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	testCases := []struct {
+		spec     string
+		from     string
+		expected string
+	}{
+		{"* * * * *", "2025-03-10 12:00", "2025-03-10 12:01"},
+		{"*/15 * * * *", "2025-03-10 12:07", "2025-03-10 12:15"},
+		{"0 * * * *", "2025-03-10 12:00", "2025-03-10 13:00"},
+		{"@hourly", "2025-03-10 23:30", "2025-03-11 00:00"},
+		{"@daily", "2025-12-31 08:00", "2026-01-01 00:00"},
+		{"30 3 * * *", "2025-03-10 03:30", "2025-03-11 03:30"},
+		{"0 9-17/4 * * *", "2025-03-10 13:00", "2025-03-10 17:00"},
+		{"0 0 * * mon-fri", "2025-03-08 12:00", "2025-03-10 00:00"}, // From Saturday
+		{"0 0 * * 7", "2025-03-10 12:00", "2025-03-16 00:00"},       // Sunday as 7
+		{"0 0 1 * *", "2025-03-10 12:00", "2025-04-01 00:00"},
+		{"0 0 31 * *", "2025-04-01 00:00", "2025-05-31 00:00"},
+		{"0 0 1,15 * 5", "2025-03-02 00:00", "2025-03-07 00:00"}, // Day of month or Friday
+		{"0 12 * feb *", "2025-03-10 12:00", "2026-02-01 12:00"},
+		{"0 0 29 2 *", "2025-03-01 00:00", "2028-02-29 00:00"},
+	}
+
+	for _, tc := range testCases {
+		schedule, err := Parse(tc.spec)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tc.spec, err)
+			continue
+		}
+
+		if next := schedule.Next(utc(tc.from)); !next.Equal(utc(tc.expected)) {
+			t.Errorf("Next(%q, %s) = %s; want %s", tc.spec, tc.from, next.Format("2006-01-02 15:04"), tc.expected)
+		}
+	}
+}
+
+func TestNextTimezone(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := Parse("0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 03:00 in Amsterdam is 02:00 UTC in winter and 01:00 UTC in summer
+	next := schedule.Next(time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC).In(amsterdam))
+	if want := time.Date(2025, 3, 11, 2, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("Next in winter = %s; want %s", next.UTC(), want)
+	}
+
+	next = schedule.Next(time.Date(2025, 7, 10, 12, 0, 0, 0, time.UTC).In(amsterdam))
+	if want := time.Date(2025, 7, 11, 1, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("Next in summer = %s; want %s", next.UTC(), want)
+	}
+}
+
+func TestNextImpossible(t *testing.T) {
+	schedule, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Errorf("Next = %s; want zero time", next)
+	}
+}
@@ -0,0 +1,162 @@
+// Package password hashes and verifies user passwords.
+//
+// New hashes use argon2id with a random salt and are encoded in the PHC string
+// format. Hashes created by the previous implementation, both argon2id without
+// a version field and the PBKDF2 format inherited from ASP.NET Identity, can
+// still be verified. NeedsRehash reports hashes that should be replaced after
+// the next successful login.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Params are the argon2id parameters used to hash new passwords
+type Params struct {
+	Memory     uint32 // KiB
+	Iterations uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// DefaultParams follow the second recommended option of RFC 9106
+var DefaultParams = Params{
+	Memory:     64 * 1024,
+	Iterations: 3,
+	Threads:    4,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+const (
+	legacyFormatMarker    = 0x1
+	legacyIterationRounds = 10000
+	legacySubkeyLength    = 256 / 8
+	legacySaltSize        = 128 / 8
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// Hash hashes the password with DefaultParams
+func Hash(password string) (string, error) {
+	return HashWithParams(password, DefaultParams)
+}
+
+// HashWithParams hashes the password with argon2id and a random salt
+func HashWithParams(password string, params Params) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Threads, params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify reports whether the password matches the hash
+func Verify(password string, hash string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false
+		}
+
+		computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(computed, key) == 1
+	}
+
+	salt, subkey, err := decodeLegacy(hash)
+	if err != nil {
+		return false
+	}
+
+	computed := pbkdf2.Key([]byte(password), salt, legacyIterationRounds, legacySubkeyLength, sha256.New)
+	return subtle.ConstantTimeCompare(computed, subkey) == 1
+}
+
+// NeedsRehash reports whether the hash uses a legacy format or parameters
+// other than DefaultParams
+func NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, "$argon2id$v=") {
+		return true
+	}
+
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != DefaultParams.Memory ||
+		params.Iterations != DefaultParams.Iterations ||
+		params.Threads != DefaultParams.Threads ||
+		uint32(len(salt)) != DefaultParams.SaltLength ||
+		uint32(len(key)) != DefaultParams.KeyLength
+}
+
+// decodeArgon2 parses an argon2id hash in PHC string format. The version field
+// is optional, as hashes created by the previous implementation omit it.
+func decodeArgon2(hash string) (Params, []byte, []byte, error) {
+	var params Params
+
+	parts := strings.Split(strings.TrimPrefix(hash, "$argon2id$"), "$")
+	if len(parts) == 4 {
+		var version int
+		if _, err := fmt.Sscanf(parts[0], "v=%d", &version); err != nil || version != argon2.Version {
+			return params, nil, nil, ErrInvalidHash
+		}
+		parts = parts[1:]
+	}
+	if len(parts) != 3 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[0], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Threads); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// decodeLegacy parses a base64 encoded PBKDF2 hash: a format marker followed
+// by the salt and the subkey
+func decodeLegacy(hash string) ([]byte, []byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil {
+		return nil, nil, ErrInvalidHash
+	}
+
+	if len(decoded) != 1+legacySaltSize+legacySubkeyLength || decoded[0] != legacyFormatMarker {
+		return nil, nil, ErrInvalidHash
+	}
+
+	return decoded[1 : 1+legacySaltSize], decoded[1+legacySaltSize:], nil
+}
@@ -0,0 +1,76 @@
+package password
+
+import "testing"
+
+// Hashes of the password "fundermaps" in every supported format
+const (
+	fixtureArgon2   = "$argon2id$v=19$m=65536,t=3,p=4$6UYD5hfQRtFpJsn9Y8okvg$d0K8t2+XTG6BRERPhr2DTDS+fLF8nGIn/8NRbeSmlEI"
+	fixtureArgon2V0 = "$argon2id$m=65536,t=1,p=4$c29tZXNhbHQ$A+wosJVXarEUPNewtpxOqdEM3QSnKJEg4nkn1qqbDuA"
+	fixtureLegacy   = "AXNvbWVzYWx0c29tZXNhbHTpBI9+NA5G2feoQ4kLOihNk0DeHRLHTXMXZoHcXbQSPg=="
+)
+
+func TestVerify(t *testing.T) {
+	testCases := []struct {
+		name     string
+		password string
+		hash     string
+		expected bool
+	}{
+		{"argon2id", "fundermaps", fixtureArgon2, true},
+		{"argon2id wrong password", "Fundermaps", fixtureArgon2, false},
+		{"argon2id without version", "fundermaps", fixtureArgon2V0, true},
+		{"argon2id without version wrong password", "fundermap", fixtureArgon2V0, false},
+		{"legacy", "fundermaps", fixtureLegacy, true},
+		{"legacy wrong password", "", fixtureLegacy, false},
+		{"empty hash", "fundermaps", "", false},
+		{"malformed argon2id", "fundermaps", "$argon2id$v=19$m=65536$abc", false},
+		{"malformed legacy", "fundermaps", "AXNvbWVzYWx0", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := Verify(tc.password, tc.hash); result != tc.expected {
+				t.Errorf("Verify() = %v, want %v", result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	first, err := Hash("fundermaps")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	second, err := Hash("fundermaps")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+
+	if first == second {
+		t.Error("Hash() returned the same hash twice, salt is not random")
+	}
+	if !Verify("fundermaps", first) {
+		t.Error("Verify() = false for freshly created hash")
+	}
+	if NeedsRehash(first) {
+		t.Error("NeedsRehash() = true for freshly created hash")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	testCases := []struct {
+		hash     string
+		expected bool
+	}{
+		{fixtureArgon2, false},
+		{fixtureArgon2V0, true},
+		{fixtureLegacy, true},
+		{"$argon2id$v=19$m=19456,t=2,p=1$6UYD5hfQRtFpJsn9Y8okvg$d0K8t2+XTG6BRERPhr2DTDS+fLF8nGIn/8NRbeSmlEI", true},
+	}
+
+	for _, tc := range testCases {
+		if result := NeedsRehash(tc.hash); result != tc.expected {
+			t.Errorf("NeedsRehash(%q) = %v, want %v", tc.hash, result, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateRandomString(t *testing.T) {
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	for _, limit := range []int{0, 1, 16, 40, 300} {
+		result := GenerateRandomString(limit)
+		if len(result) != limit {
+			t.Errorf("GenerateRandomString(%d) length = %d", limit, len(result))
+		}
+		if strings.Trim(result, chars) != "" {
+			t.Errorf("GenerateRandomString(%d) = %q contains invalid characters", limit, result)
+		}
+	}
+
+	if GenerateRandomString(40) == GenerateRandomString(40) {
+		t.Error("GenerateRandomString() returned the same value twice")
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	expected := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if result := HashToken("hello"); result != expected {
+		t.Errorf("HashToken() = %s, want %s", result, expected)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	expected := `100\% \_ \\`
+	if result := EscapeLike(`100% _ \`); result != expected {
+		t.Errorf("EscapeLike() = %s, want %s", result, expected)
+	}
+}
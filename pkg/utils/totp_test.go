@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238, appendix B. The RFC lists 8 digit codes, the
+// expected values below are their last 6 digits.
+func TestTOTP(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	testCases := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tc := range testCases {
+		code, err := TOTP(secret, time.Unix(tc.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTP() error = %v", err)
+		}
+		if code != tc.expected {
+			t.Errorf("TOTP(%d) = %s, want %s", tc.unix, code, tc.expected)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+
+	now := time.Now()
+	code, err := TOTP(secret, now)
+	if err != nil {
+		t.Fatalf("TOTP() error = %v", err)
+	}
+
+	if !VerifyTOTP(secret, code, now) {
+		t.Error("VerifyTOTP() = false for current code")
+	}
+	if !VerifyTOTP(secret, code, now.Add(30*time.Second)) {
+		t.Error("VerifyTOTP() = false for code from previous period")
+	}
+	if VerifyTOTP(secret, code, now.Add(2*time.Minute)) {
+		t.Error("VerifyTOTP() = true for expired code")
+	}
+	if VerifyTOTP(secret, "", now) {
+		t.Error("VerifyTOTP() = true for empty code")
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret() error = %v", err)
+	}
+
+	now := time.Now()
+	code, err := TOTP(secret, now)
+	if err != nil {
+		t.Fatalf("TOTP() error = %v", err)
+	}
+
+	// The step stays the same when the code is checked a period later
+	step := now.Unix() / 30
+	if matched, ok := MatchTOTP(secret, code, now); !ok || matched != step {
+		t.Errorf("MatchTOTP() = %d, %v; want %d, true", matched, ok, step)
+	}
+	if matched, ok := MatchTOTP(secret, code, now.Add(30*time.Second)); !ok || matched != step {
+		t.Errorf("MatchTOTP() a period later = %d, %v; want %d, true", matched, ok, step)
+	}
+}